@@ -0,0 +1,451 @@
+package appinsights
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	errClosed          = errors.New("handler is closed")
+	errRetryExhausted  = errors.New("retries exhausted")
+	errRetryTimeout    = errors.New("retry timeout expired")
+	errShutdownTimeout = errors.New("shutdown timed out")
+)
+
+// retryDelays are the delays before each retry of a failed submission.
+var retryDelays = []time.Duration{
+	10 * time.Second,
+	30 * time.Second,
+	60 * time.Second,
+}
+
+// Bounds of the interval between the attempts to transmit stored batches.
+var (
+	storageRetryMinInterval = 5 * time.Second
+	storageRetryMaxInterval = 5 * time.Minute
+)
+
+// telemetryChannel buffers telemetry items in memory
+// and submits them in batches.
+type telemetryChannel struct {
+	transmitter *transmitter
+	// storage keeps the failed batches, which may be nil.
+	storage          *storage
+	failures         *failureReporter
+	throttle         throttle
+	maxBatchSize     int
+	maxBatchInterval time.Duration
+
+	items   chan *envelope
+	control chan channelControl
+	// stopping is closed when the channel begins to shut down.
+	stopping chan struct{}
+	// closeCtx limits the retries after stopping is closed.
+	closeCtx context.Context
+	// ctx is canceled when closeCtx is done,
+	// which aborts the transmissions in progress.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// done is closed when the channel has shut down.
+	done chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+
+	transmissions sync.WaitGroup
+	// inflight are the channels closed when each transmission is complete.
+	inflight   map[chan struct{}]struct{}
+	inflightMu sync.Mutex
+}
+
+// channelControl is a request to flush or to close the channel.
+type channelControl struct {
+	// closeCtx is given when the channel is closing.
+	closeCtx context.Context
+	// flushed receives the transmissions to wait for when the channel is flushing.
+	flushed chan<- []chan struct{}
+}
+
+func newTelemetryChannel(t *transmitter, s *storage, failures *failureReporter, maxBatchSize int, maxBatchInterval time.Duration) *telemetryChannel {
+	c := &telemetryChannel{
+		transmitter:      t,
+		storage:          s,
+		failures:         failures,
+		maxBatchSize:     maxBatchSize,
+		maxBatchInterval: maxBatchInterval,
+		items:            make(chan *envelope),
+		control:          make(chan channelControl),
+		stopping:         make(chan struct{}),
+		done:             make(chan struct{}),
+		inflight:         make(map[chan struct{}]struct{}),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	go c.run()
+
+	if s != nil {
+		c.transmissions.Add(1)
+		go func() {
+			defer c.transmissions.Done()
+			c.retryStored()
+		}()
+	}
+
+	return c
+}
+
+// send queues the item for submission.
+// The item is dropped if the channel was already closed.
+func (c *telemetryChannel) send(item *envelope) {
+	c.mu.RLock()
+	if !c.closed {
+		c.items <- item
+		c.mu.RUnlock()
+		return
+	}
+	c.mu.RUnlock()
+
+	c.failures.reportRejected(&TransmissionError{Dropped: 1, Err: errClosed})
+}
+
+// flush submits the buffered items immediately
+// and waits until all the transmissions in progress are complete or ctx is done.
+func (c *telemetryChannel) flush(ctx context.Context) error {
+	flushed := make(chan []chan struct{}, 1)
+
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return errClosed
+	}
+	select {
+	case c.control <- channelControl{flushed: flushed}:
+		c.mu.RUnlock()
+	case <-ctx.Done():
+		c.mu.RUnlock()
+		return ctx.Err()
+	}
+
+	for _, done := range <-flushed {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// close submits the buffered items and shuts down the channel.
+// The failed submissions are retried until ctx is done,
+// when the transmissions in progress are canceled
+// and the items not delivered are reported as dropped.
+// The returned channel is closed when all submissions are complete.
+func (c *telemetryChannel) close(ctx context.Context) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		c.failures.startCollecting()
+		c.control <- channelControl{closeCtx: ctx}
+	}
+
+	return c.done
+}
+
+func (c *telemetryChannel) run() {
+	var buffer []*envelope
+	// dropped is the number of items dropped while throttled,
+	// which are reported together when the throttling ends
+	// so that the items logged by OnError cannot feed back into it.
+	dropped := 0
+	reportDropped := func() {
+		if dropped > 0 {
+			c.failures.report(&TransmissionError{Dropped: dropped, Err: errThrottled})
+			dropped = 0
+		}
+	}
+
+	timer := time.NewTimer(c.maxBatchInterval)
+	timer.Stop()
+
+	for {
+		select {
+		case item := <-c.items:
+			throttled := c.throttle.remaining() > 0
+			if throttled {
+				// The items are held back until the throttling ends.
+				if len(buffer) >= c.maxBatchSize*maxHeldBatches {
+					c.throttle.dropped.Add(1)
+					dropped++
+					continue
+				}
+				c.throttle.held.Add(1)
+			}
+			buffer = append(buffer, item)
+			if len(buffer) >= c.maxBatchSize && !throttled {
+				timer.Stop()
+				c.submit(buffer)
+				buffer = nil
+			} else if len(buffer) == 1 {
+				timer.Reset(c.maxBatchInterval)
+			}
+
+		case <-timer.C:
+			if wait := c.throttle.remaining(); wait > 0 {
+				timer.Reset(wait)
+				continue
+			}
+			reportDropped()
+			c.submit(buffer)
+			buffer = nil
+
+		case ctl := <-c.control:
+			timer.Stop()
+			if ctl.flushed != nil {
+				reportDropped()
+				c.submit(buffer)
+				buffer = nil
+				ctl.flushed <- c.inflightTransmissions()
+				continue
+			}
+			reportDropped()
+			c.closeCtx = ctl.closeCtx
+			stop := context.AfterFunc(c.closeCtx, c.cancel)
+			close(c.stopping)
+			c.submit(buffer)
+			c.transmissions.Wait()
+			stop()
+			c.cancel()
+			close(c.done)
+			return
+		}
+	}
+}
+
+// submit starts the transmission of the items in the background.
+// The items held back while throttled are divided into batches of the maximum size.
+func (c *telemetryChannel) submit(items []*envelope) {
+	for chunk := range slices.Chunk(items, c.maxBatchSize) {
+		done := make(chan struct{})
+		c.inflightMu.Lock()
+		c.inflight[done] = struct{}{}
+		c.inflightMu.Unlock()
+
+		c.transmissions.Add(1)
+		go func() {
+			defer c.transmissions.Done()
+			defer func() {
+				c.inflightMu.Lock()
+				delete(c.inflight, done)
+				c.inflightMu.Unlock()
+				close(done)
+			}()
+			c.transmitWithRetry(chunk)
+		}()
+	}
+}
+
+// inflightTransmissions returns the channels closed
+// when each transmission in progress is complete.
+func (c *telemetryChannel) inflightTransmissions() []chan struct{} {
+	c.inflightMu.Lock()
+	defer c.inflightMu.Unlock()
+	return slices.Collect(maps.Keys(c.inflight))
+}
+
+// transmitWithRetry transmits the batch and retries on failure.
+// Once the channel begins to shut down,
+// no retry is made after the context given to close is done.
+// If the storage is available, the failed batch is stored
+// instead of being retried in memory.
+func (c *telemetryChannel) transmitWithRetry(items []*envelope) {
+
+	b, err := serialize(items)
+	if err != nil {
+		c.failures.report(&TransmissionError{Dropped: len(items) - len(b), Err: err})
+	}
+	if len(b) == 0 {
+		return
+	}
+
+	failure := &TransmissionError{}
+	held := false
+
+	for attempt := 0; ; attempt++ {
+		// Waits for the throttling caused by other batches to end.
+		if wait := c.throttle.remaining(); wait > 0 {
+			if !c.waitRetry(wait) {
+				failure.Dropped = len(b)
+				failure.Err = errors.Join(failure.Err, errThrottled, errRetryTimeout)
+				c.throttle.dropped.Add(int64(len(b)))
+				c.failures.report(failure)
+				return
+			}
+		}
+
+		result, err := c.transmitter.transmit(c.ctx, b)
+		throttled := false
+		if err == nil {
+			if result.isThrottled() {
+				c.throttle.throttle(result.retryAfter)
+				throttled = true
+				if !held {
+					c.throttle.held.Add(int64(len(b)))
+					held = true
+				}
+			} else if result.isSuccess() || result.isPartialSuccess() {
+				c.throttle.reset()
+			}
+			retry, rejected := result.split(b)
+			if rejected != nil {
+				c.failures.report(rejected)
+			}
+			if len(retry) == 0 {
+				return
+			}
+			// Only the items which can be retried are submitted again.
+			b = retry
+			result.addTo(failure)
+		} else if c.ctx.Err() != nil {
+			failure.Err = errShutdownTimeout
+		} else {
+			failure.Err = err
+		}
+		failure.Dropped = len(b)
+
+		if c.storage != nil {
+			if err := c.storage.save(b); err != nil {
+				failure.Err = errors.Join(failure.Err, err)
+				c.failures.report(failure)
+			}
+			return
+		}
+
+		if attempt >= len(retryDelays) {
+			failure.Err = errors.Join(failure.Err, errRetryExhausted)
+			if throttled {
+				c.throttle.dropped.Add(int64(len(b)))
+			}
+			c.failures.report(failure)
+			return
+		}
+
+		delay := retryDelays[attempt]
+		if throttled {
+			delay = c.throttle.remaining()
+		}
+		diagnosticsf("Waiting %s to retry submission", delay)
+		if !c.waitRetry(delay) {
+			failure.Err = errors.Join(failure.Err, errRetryTimeout)
+			if throttled {
+				c.throttle.dropped.Add(int64(len(b)))
+			}
+			c.failures.report(failure)
+			return
+		}
+	}
+}
+
+// waitRetry waits for the delay and reports whether the retry can be made.
+// Once the channel begins to shut down,
+// the wait is also limited by the context given to close.
+func (c *telemetryChannel) waitRetry(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-c.stopping:
+	}
+
+	select {
+	case <-timer.C:
+		return true
+	case <-c.closeCtx.Done():
+		return false
+	}
+}
+
+// retryStored transmits the stored batches until the channel begins to shut down.
+// The interval between the attempts grows exponentially while the transmission fails.
+func (c *telemetryChannel) retryStored() {
+	interval := storageRetryMinInterval
+	for {
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-c.stopping:
+			timer.Stop()
+			return
+		}
+
+		if c.throttle.remaining() > 0 {
+			interval = max(c.throttle.remaining(), storageRetryMinInterval)
+		} else if c.transmitStored() {
+			interval = storageRetryMinInterval
+		} else {
+			interval = min(interval*2, storageRetryMaxInterval)
+		}
+	}
+}
+
+// transmitStored transmits the stored batches one by one
+// and reports whether the endpoint was available.
+func (c *telemetryChannel) transmitStored() bool {
+	for {
+		select {
+		case <-c.stopping:
+			return true
+		default:
+		}
+
+		stored, err := c.storage.lease()
+		if err != nil {
+			diagnosticsf("Failed to load stored telemetry: %v", err)
+			return false
+		}
+		if stored == nil {
+			return true
+		}
+
+		result, err := c.transmitter.transmit(c.ctx, stored.batch)
+		if err != nil {
+			c.storage.release(stored)
+			return false
+		}
+		if result.isThrottled() {
+			c.throttle.throttle(result.retryAfter)
+		} else if result.isSuccess() || result.isPartialSuccess() {
+			c.throttle.reset()
+		}
+
+		retry, rejected := result.split(stored.batch)
+		if rejected != nil {
+			c.failures.report(rejected)
+		}
+		if len(retry) == len(stored.batch) {
+			c.storage.release(stored)
+			return false
+		}
+
+		// Replaces the stored batch with the items which can be retried.
+		if len(retry) > 0 {
+			if err := c.storage.save(retry); err != nil {
+				failure := &TransmissionError{Dropped: len(retry), Err: err}
+				result.addTo(failure)
+				c.failures.report(failure)
+			}
+		}
+		c.storage.remove(stored)
+		if len(retry) > 0 {
+			return false
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package appinsights
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingServer responds with the given status codes in order
+// and records the number of requests.
+type recordingServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests int
+}
+
+func newRecordingServer(statuses ...int) *recordingServer {
+	s := &recordingServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		status := http.StatusOK
+		if s.requests < len(s.statuses) {
+			status = s.statuses[s.requests]
+		}
+		s.requests++
+		w.WriteHeader(status)
+	}))
+	return s
+}
+
+func (s *recordingServer) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func newTestEnvelope() *envelope {
+	data := &messageData{Ver: dataVersion, Message: "message"}
+	return newEnvelope("ikey", "ikey", time.Now(), data)
+}
+
+func TestChannelSubmitsFullBatch(t *testing.T) {
+
+	server := newRecordingServer()
+	defer server.Close()
+
+	channel := newTelemetryChannel(newTransmitter(server.URL, server.Client()), nil, newFailureReporter(nil), 2, time.Hour)
+
+	for range 4 {
+		channel.send(newTestEnvelope())
+	}
+
+	<-channel.close(context.Background())
+
+	if count := server.requestCount(); count != 2 {
+		t.Errorf("expected 2 requests, but got %d", count)
+	}
+}
+
+func TestChannelSubmitsAfterInterval(t *testing.T) {
+
+	server := newRecordingServer()
+	defer server.Close()
+
+	channel := newTelemetryChannel(newTransmitter(server.URL, server.Client()), nil, newFailureReporter(nil), 100, 10*time.Millisecond)
+	defer func() { <-channel.close(context.Background()) }()
+
+	channel.send(newTestEnvelope())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.requestCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if count := server.requestCount(); count != 1 {
+		t.Errorf("expected 1 request, but got %d", count)
+	}
+}
+
+func TestChannelRetriesOnFailure(t *testing.T) {
+
+	saved := retryDelays
+	retryDelays = []time.Duration{time.Millisecond, time.Millisecond}
+	defer func() { retryDelays = saved }()
+
+	savedBackoff := throttleMinBackoff
+	throttleMinBackoff = time.Millisecond
+	defer func() { throttleMinBackoff = savedBackoff }()
+
+	cases := []struct {
+		name     string
+		statuses []int
+		requests int
+	}{
+		{"retryable", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, 3},
+		{"exhausted", []int{http.StatusInternalServerError, 500, 500, 500}, 3},
+		{"not retryable", []int{http.StatusBadRequest}, 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			server := newRecordingServer(c.statuses...)
+			defer server.Close()
+
+			channel := newTelemetryChannel(newTransmitter(server.URL, server.Client()), nil, newFailureReporter(nil), 100, time.Hour)
+			channel.send(newTestEnvelope())
+			<-channel.close(context.Background())
+
+			if count := server.requestCount(); count != c.requests {
+				t.Errorf("expected %d requests, but got %d", c.requests, count)
+			}
+		})
+	}
+}
+
+func TestChannelClosedTwice(t *testing.T) {
+
+	server := newRecordingServer()
+	defer server.Close()
+
+	channel := newTelemetryChannel(newTransmitter(server.URL, server.Client()), nil, newFailureReporter(nil), 100, time.Hour)
+	channel.send(newTestEnvelope())
+
+	<-channel.close(context.Background())
+	<-channel.close(context.Background())
+
+	// discarded
+	channel.send(newTestEnvelope())
+
+	if count := server.requestCount(); count != 1 {
+		t.Errorf("expected 1 request, but got %d", count)
+	}
+}
+
+func TestChannelTransmitsStoredBatch(t *testing.T) {
+
+	saved := storageRetryMinInterval
+	storageRetryMinInterval = 10 * time.Millisecond
+	defer func() { storageRetryMinInterval = saved }()
+
+	server := newRecordingServer(http.StatusServiceUnavailable)
+	defer server.Close()
+
+	s := newTestStorage(t)
+
+	channel := newTelemetryChannel(newTransmitter(server.URL, server.Client()), s, newFailureReporter(nil), 1, time.Hour)
+	defer func() { <-channel.close(context.Background()) }()
+
+	channel.send(newTestEnvelope())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.requestCount() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if count := server.requestCount(); count != 2 {
+		t.Errorf("expected 2 requests, but got %d", count)
+	}
+
+	// Waits for the transmitted batch to be removed.
+	for time.Now().Before(deadline) {
+		if entries, _ := os.ReadDir(s.dir); len(entries) == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("transmitted batch was not removed")
+}
+
+func TestChannelStoresBatchOnClose(t *testing.T) {
+
+	server := newRecordingServer(http.StatusServiceUnavailable)
+	defer server.Close()
+
+	s := newTestStorage(t)
+
+	channel := newTelemetryChannel(newTransmitter(server.URL, server.Client()), s, newFailureReporter(nil), 100, time.Hour)
+	channel.send(newTestEnvelope())
+	<-channel.close(context.Background())
+
+	stored, _ := s.lease()
+	if stored == nil {
+		t.Fatal("batch was not stored")
+	}
+	if len(stored.batch) != 1 {
+		t.Errorf("expected 1 item, but got %d", len(stored.batch))
+	}
+}
+
+func TestChannelRetriesPartiallyRejectedItems(t *testing.T) {
+
+	saved := retryDelays
+	retryDelays = []time.Duration{time.Millisecond}
+	defer func() { retryDelays = saved }()
+
+	var mu sync.Mutex
+	var received []int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		b, err := decompress(payload)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, len(b))
+		if len(received) > 1 {
+			return
+		}
+
+		// Rejects the second item permanently and the last one temporarily.
+		w.WriteHeader(http.StatusPartialContent)
+		fmt.Fprintf(w, `{"itemsReceived":%d,"itemsAccepted":%d,"errors":[`+
+			`{"index":1,"statusCode":400,"message":"invalid"},`+
+			`{"index":%d,"statusCode":503,"message":"unavailable"}]}`,
+			len(b), len(b)-2, len(b)-1)
+	}))
+	defer server.Close()
+
+	var dropped int
+	failures := newFailureReporter(func(err error, droppedCount int) {
+		dropped += droppedCount
+	})
+
+	channel := newTelemetryChannel(newTransmitter(server.URL, server.Client()), nil, failures, 4, time.Hour)
+	for range 4 {
+		channel.send(newTestEnvelope())
+	}
+	<-channel.close(context.Background())
+	failures.wait(context.Background())
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(received) != "[4 1]" {
+		t.Errorf("unexpected items received: %v", received)
+	}
+	if dropped != 1 {
+		t.Errorf("expected 1 dropped item, but got %d", dropped)
+	}
+}
+
+func TestTransmissionResultSplit(t *testing.T) {
+
+	b := newTestBatch(t, 3)
+
+	cases := []struct {
+		name     string
+		result   transmissionResult
+		retry    int
+		rejected int
+	}{
+		{"success", transmissionResult{statusCode: http.StatusOK}, 0, 0},
+		{"retryable", transmissionResult{statusCode: http.StatusServiceUnavailable}, 3, 0},
+		{"not retryable", transmissionResult{statusCode: http.StatusBadRequest}, 0, 3},
+		{"partial", transmissionResult{
+			statusCode: http.StatusPartialContent,
+			response: &trackResponse{
+				ItemsReceived: 3,
+				ItemsAccepted: 1,
+				Errors: []ItemError{
+					{Index: 0, StatusCode: http.StatusTooManyRequests},
+					{Index: 2, StatusCode: http.StatusBadRequest},
+				},
+			},
+		}, 1, 1},
+		{"partial without errors", transmissionResult{
+			statusCode: http.StatusPartialContent,
+			response:   &trackResponse{ItemsReceived: 3, ItemsAccepted: 1},
+		}, 0, 2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			retry, rejected := c.result.split(b)
+			if len(retry) != c.retry {
+				t.Errorf("expected %d items to retry, but got %d", c.retry, len(retry))
+			}
+			var dropped int
+			if rejected != nil {
+				dropped = rejected.Dropped
+			}
+			if dropped != c.rejected {
+				t.Errorf("expected %d rejected items, but got %d", c.rejected, dropped)
+			}
+		})
+	}
+}
+
+func TestChannelHoldsBackItemsWhileThrottled(t *testing.T) {
+
+	saved := retryDelays
+	retryDelays = []time.Duration{time.Millisecond, time.Millisecond}
+	defer func() { retryDelays = saved }()
+
+	var mu sync.Mutex
+	var times []time.Time
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		times = append(times, time.Now())
+		if len(times) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer server.Close()
+
+	channel := newTelemetryChannel(newTransmitter(server.URL, server.Client()), nil, newFailureReporter(nil), 1, time.Hour)
+	channel.send(newTestEnvelope())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for channel.throttle.remaining() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// held back although the batch is full
+	channel.send(newTestEnvelope())
+
+	<-channel.close(context.Background())
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(times) != 3 {
+		t.Fatalf("expected 3 requests, but got %d", len(times))
+	}
+	if elapsed := times[1].Sub(times[0]); elapsed < time.Second {
+		t.Errorf("retried before Retry-After: %s", elapsed)
+	}
+
+	stats := channel.throttle.stats()
+	if stats.Throttled != 1 || stats.Held != 2 || stats.Dropped != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-1", 0},
+		{"Thu, 01 Jan 2026 00:00:30 GMT", 30 * time.Second},
+		{"Wed, 31 Dec 2025 23:59:00 GMT", 0},
+		{"soon", 0},
+	}
+
+	for _, c := range cases {
+		if actual := parseRetryAfter(c.value, now); actual != c.expected {
+			t.Errorf("parseRetryAfter(%q) = %s, expected %s", c.value, actual, c.expected)
+		}
+	}
+}
+
+func TestSerializeSkipsInvalidItem(t *testing.T) {
+
+	invalid := &messageData{
+		Ver:          dataVersion,
+		Message:      "message",
+		Measurements: map[string]float64{"ratio": math.NaN()},
+	}
+	items := []*envelope{
+		newTestEnvelope(),
+		newEnvelope("ikey", "ikey", time.Now(), invalid),
+		newTestEnvelope(),
+	}
+
+	b, err := serialize(items)
+	if err == nil {
+		t.Error("error must be returned")
+	}
+	if len(b) != 2 {
+		t.Errorf("expected 2 items, but got %d", len(b))
+	}
+}
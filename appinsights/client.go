@@ -0,0 +1,92 @@
+package appinsights
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"strings"
+	"time"
+)
+
+// telemetryClient wraps telemetry data in envelopes
+// and passes them to the channel.
+// It is shared by all handlers derived from the same handler.
+type telemetryClient struct {
+	iKey string
+	// nameIKey is the instrumentation key without hyphens
+	// used in envelope names.
+	nameIKey string
+	// tags are the context tags common to all telemetry items.
+	tags    map[string]string
+	channel *telemetryChannel
+	// truncations counts the fields truncated by the handlers.
+	truncations truncationCounter
+}
+
+func newTelemetryClient(cs *ConnectionString, opts *HandlerOptions) (*telemetryClient, error) {
+
+	var endpointUrl = *cs.IngestionEndpoint
+	endpointUrl.Path = ingestionEndpointPath
+
+	transmitter := newTransmitter(endpointUrl.String(), opts.Client)
+
+	if opts.TokenProvider != nil {
+		transmitter.tokenProvider = opts.TokenProvider
+		transmitter.scope = tokenScope(cs)
+	} else if strings.EqualFold(cs.Authorization, aadAuthorization) {
+		return nil, errors.New("connection string requires Microsoft Entra ID authorization but token provider is missing")
+	}
+
+	failures := newFailureReporter(opts.OnError)
+
+	var storage *storage
+	if opts.StorageDir != "" {
+		var err error
+		storage, err = newStorage(opts.StorageDir, cs.InstrumentationKey, transmitter.endpoint, opts.StorageMaxSize, opts.StorageMaxAge, failures)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &telemetryClient{
+		iKey:     cs.InstrumentationKey,
+		nameIKey: strings.ReplaceAll(cs.InstrumentationKey, "-", ""),
+		tags:     commonTags(opts),
+		channel:  newTelemetryChannel(transmitter, storage, failures, opts.MaxBatchSize, opts.MaxBatchInterval),
+	}, nil
+}
+
+// track submits the telemetry data.
+// The given tags take precedence over the common tags of the client.
+// sampleRate is the percentage of the telemetry being submitted.
+func (c *telemetryClient) track(t time.Time, data telemetryData, tags map[string]string, sampleRate float64) {
+
+	item := newEnvelope(c.iKey, c.nameIKey, t, data)
+
+	item.Tags = make(map[string]string, len(c.tags)+len(tags))
+	maps.Copy(item.Tags, c.tags)
+	maps.Copy(item.Tags, tags)
+
+	if sampleRate < 100 {
+		item.SampleRate = sampleRate
+	}
+
+	c.channel.send(item)
+}
+
+// flush submits the buffered telemetry
+// and waits for the transmission until ctx is done.
+func (c *telemetryClient) flush(ctx context.Context) error {
+	return c.channel.flush(ctx)
+}
+
+// shutdown flushes the buffered telemetry and stops the client.
+// It waits for the transmission until ctx is done,
+// when the transmissions in progress are canceled,
+// and returns the error reporting the telemetry not delivered
+// after the failures are notified to OnError.
+func (c *telemetryClient) shutdown(ctx context.Context) error {
+	<-c.channel.close(ctx)
+	c.channel.failures.wait(ctx)
+	return c.channel.failures.collectedError()
+}
@@ -0,0 +1,129 @@
+package appinsights
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Default endpoints used when a connection string has neither the endpoint nor EndpointSuffix.
+const (
+	defaultIngestionEndpoint = "https://dc.services.visualstudio.com/"
+	defaultLiveEndpoint      = "https://rt.services.visualstudio.com/"
+)
+
+// Prefixes of the endpoints built from EndpointSuffix.
+const (
+	ingestionEndpointPrefix = "dc"
+	liveEndpointPrefix      = "live"
+)
+
+// maxConnectionStringLength is the maximum length of a connection string
+// accepted by the official SDKs.
+const maxConnectionStringLength = 4096
+
+// ConnectionString is a parsed connection string of an Application Insights resource.
+type ConnectionString struct {
+	// InstrumentationKey identifies the resource.
+	InstrumentationKey string
+	// IngestionEndpoint is the endpoint to which the telemetry is submitted.
+	IngestionEndpoint *url.URL
+	// LiveEndpoint is the endpoint of Live Metrics.
+	LiveEndpoint *url.URL
+	// EndpointSuffix is the suffix of the endpoints of the cloud,
+	// such as "applicationinsights.azure.cn", which may be empty.
+	EndpointSuffix string
+	// Location is the region prepended to the endpoints
+	// built from EndpointSuffix, which may be empty.
+	Location string
+	// Authorization is the authorization method, such as "AAD", which may be empty.
+	Authorization string
+	// AADAudience is the audience of the Microsoft Entra ID token
+	// used for the authorization, which may be empty.
+	AADAudience string
+}
+
+// ParseConnectionString parses the connection string of an Application Insights resource.
+// The keys are matched case-insensitively.
+// When IngestionEndpoint or LiveEndpoint is not given,
+// it is built from EndpointSuffix and Location as the official SDKs do,
+// or defaults to the endpoint of the Azure public cloud.
+func ParseConnectionString(connectionString string) (*ConnectionString, error) {
+
+	connectionString = strings.TrimSpace(connectionString)
+	if connectionString == "" {
+		return nil, errors.New("connection string is empty")
+	}
+	if len(connectionString) > maxConnectionStringLength {
+		return nil, fmt.Errorf("connection string exceeds %d characters", maxConnectionStringLength)
+	}
+
+	values := make(map[string]string)
+
+	for _, pair := range strings.Split(connectionString, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, found := strings.Cut(pair, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		if !found || key == "" || value == "" {
+			return nil, fmt.Errorf("connection string has an invalid pair: %q", pair)
+		}
+		if _, duplicated := values[key]; duplicated {
+			return nil, fmt.Errorf("connection string has duplicated key: %s", key)
+		}
+		values[key] = value
+	}
+
+	cs := &ConnectionString{
+		InstrumentationKey: values["instrumentationkey"],
+		EndpointSuffix:     strings.Trim(values["endpointsuffix"], "./"),
+		Location:           strings.Trim(values["location"], "./"),
+		Authorization:      values["authorization"],
+		AADAudience:        values["aadaudience"],
+	}
+
+	if cs.InstrumentationKey == "" {
+		return nil, errors.New("instrumentation key is missing")
+	}
+
+	var err error
+	cs.IngestionEndpoint, err = cs.endpoint(values["ingestionendpoint"], ingestionEndpointPrefix, defaultIngestionEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("ingestion endpoint is not a valid URL: %w", err)
+	}
+	cs.LiveEndpoint, err = cs.endpoint(values["liveendpoint"], liveEndpointPrefix, defaultLiveEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("live endpoint is not a valid URL: %w", err)
+	}
+
+	return cs, nil
+}
+
+// endpoint returns the explicit endpoint if given,
+// otherwise the one built from EndpointSuffix, or the default one.
+func (cs *ConnectionString) endpoint(explicit, prefix, defaultEndpoint string) (*url.URL, error) {
+	endpoint := explicit
+	if endpoint == "" {
+		if cs.EndpointSuffix != "" {
+			host := prefix + "." + cs.EndpointSuffix
+			if cs.Location != "" {
+				host = cs.Location + "." + host
+			}
+			endpoint = "https://" + host + "/"
+		} else {
+			endpoint = defaultEndpoint
+		}
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%s is not an absolute HTTP URL", endpoint)
+	}
+	return u, nil
+}
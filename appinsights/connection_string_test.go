@@ -0,0 +1,114 @@
+package appinsights
+
+import "testing"
+
+func TestParseValidConnectionString(t *testing.T) {
+
+	connectionString := "InstrumentationKey=f81d4fae-7dec-11d0-a765-00a0c91e6bf6;IngestionEndpoint=https://southcentralus.in.applicationinsights.azure.com/"
+
+	spec, err := ParseConnectionString(connectionString)
+	if err != nil {
+		t.Fatalf("failed to parse valid connection string: %v", err)
+	}
+
+	if spec.InstrumentationKey != "f81d4fae-7dec-11d0-a765-00a0c91e6bf6" {
+		t.Errorf("instrument key is wrong: %s", spec.InstrumentationKey)
+	}
+
+	if spec.IngestionEndpoint == nil {
+		t.Fatalf("ingestion endpoint is nil")
+	}
+
+	if spec.IngestionEndpoint.String() != "https://southcentralus.in.applicationinsights.azure.com/" {
+		t.Errorf("ingestion endpoint is wrong: %v", spec.IngestionEndpoint)
+	}
+}
+
+func TestParseConnectionStringEndpoints(t *testing.T) {
+
+	cases := []struct {
+		name              string
+		connectionString  string
+		ingestionEndpoint string
+		liveEndpoint      string
+	}{
+		{
+			"key only",
+			"InstrumentationKey=00000000-0000-0000-0000-000000000000",
+			"https://dc.services.visualstudio.com/",
+			"https://rt.services.visualstudio.com/",
+		},
+		{
+			"Azure China",
+			"InstrumentationKey=00000000-0000-0000-0000-000000000000;EndpointSuffix=applicationinsights.azure.cn",
+			"https://dc.applicationinsights.azure.cn/",
+			"https://live.applicationinsights.azure.cn/",
+		},
+		{
+			"Azure Government with location",
+			"instrumentationkey=00000000-0000-0000-0000-000000000000;endpointsuffix=applicationinsights.us;LOCATION=usgovvirginia",
+			"https://usgovvirginia.dc.applicationinsights.us/",
+			"https://usgovvirginia.live.applicationinsights.us/",
+		},
+		{
+			"explicit endpoints take precedence",
+			"InstrumentationKey=00000000-0000-0000-0000-000000000000;EndpointSuffix=applicationinsights.us;" +
+				"IngestionEndpoint=https://custom.example.com/;LiveEndpoint=https://live.example.com/",
+			"https://custom.example.com/",
+			"https://live.example.com/",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cs, err := ParseConnectionString(c.connectionString)
+			if err != nil {
+				t.Fatalf("failed to parse connection string: %v", err)
+			}
+			if cs.IngestionEndpoint.String() != c.ingestionEndpoint {
+				t.Errorf("unexpected ingestion endpoint: %v", cs.IngestionEndpoint)
+			}
+			if cs.LiveEndpoint.String() != c.liveEndpoint {
+				t.Errorf("unexpected live endpoint: %v", cs.LiveEndpoint)
+			}
+		})
+	}
+}
+
+func TestParseConnectionStringAuthorization(t *testing.T) {
+
+	cs, err := ParseConnectionString(
+		"InstrumentationKey=00000000-0000-0000-0000-000000000000;Authorization=AAD;AADAudience=https://monitor.azure.us/")
+	if err != nil {
+		t.Fatalf("failed to parse connection string: %v", err)
+	}
+	if cs.Authorization != "AAD" {
+		t.Errorf("unexpected authorization: %s", cs.Authorization)
+	}
+	if cs.AADAudience != "https://monitor.azure.us/" {
+		t.Errorf("unexpected audience: %s", cs.AADAudience)
+	}
+}
+
+func TestParseInvalidConnectionString(t *testing.T) {
+
+	cases := []struct {
+		name             string
+		connectionString string
+	}{
+		{"empty", " "},
+		{"key missing", "IngestionEndpoint=https://dc.services.visualstudio.com/"},
+		{"malformed pair", "InstrumentationKey=00000000-0000-0000-0000-000000000000;Location"},
+		{"duplicated key", "InstrumentationKey=1;instrumentationKey=2"},
+		{"relative endpoint", "InstrumentationKey=00000000-0000-0000-0000-000000000000;IngestionEndpoint=/v2/track"},
+		{"unsupported scheme", "InstrumentationKey=00000000-0000-0000-0000-000000000000;LiveEndpoint=ftp://example.com/"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := ParseConnectionString(c.connectionString); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package appinsights
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+)
+
+type attrsKey struct{}
+
+// ContextWithAttrs returns a copy of ctx which carries the given attributes
+// in addition to those already carried by ctx.
+// The handler adds the attributes to every record logged with the returned context
+// when [HandlerOptions.ContextExtractors] includes [AttrsFromContext].
+func ContextWithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	if len(attrs) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, attrsKey{}, slices.Concat(AttrsFromContext(ctx), attrs))
+}
+
+// AttrsFromContext returns the attributes carried by ctx,
+// which were given by [ContextWithAttrs].
+// It is the default extractor of [HandlerOptions.ContextExtractors].
+func AttrsFromContext(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// defaultContextExtractors returns the default value of [HandlerOptions.ContextExtractors].
+func defaultContextExtractors() []func(context.Context) []slog.Attr {
+	return []func(context.Context) []slog.Attr{AttrsFromContext}
+}
@@ -0,0 +1,84 @@
+package appinsights_test
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"testing"
+
+	"github.com/openclosed-dev/slogan/appinsights"
+)
+
+type tenantKey struct{}
+
+func TestContextAttrs(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.ContextExtractors = append(opts.ContextExtractors, func(ctx context.Context) []slog.Attr {
+		if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+			return []slog.Attr{slog.String("tenant", tenant)}
+		}
+		return nil
+	})
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	ctx := context.WithValue(context.Background(), tenantKey{}, "contoso")
+	ctx = appinsights.ContextWithAttrs(ctx, slog.String("feature", "beta"))
+	ctx = appinsights.ContextWithAttrs(ctx, slog.String("user.id", "user-1"), slog.String("key1", "context"))
+
+	logger := slog.New(handler).WithGroup("group1")
+	logger.InfoContext(ctx, "message", "key1", "value1")
+	logger.Info("message")
+
+	handler.Close()
+
+	item := server.getTelemetry()
+
+	expected := map[string]string{
+		"tenant":      "contoso",
+		"feature":     "beta",
+		"key1":        "context",
+		"group1.key1": "value1",
+	}
+	if !maps.Equal(item.properties(), expected) {
+		t.Errorf("unexpected properties: %v", item.properties())
+	}
+	if item.Tags["ai.user.id"] != "user-1" {
+		t.Errorf("unexpected tags: %v", item.Tags)
+	}
+
+	item = server.getTelemetry()
+	if len(item.properties()) != 0 {
+		t.Errorf("unexpected properties: %v", item.properties())
+	}
+}
+
+func TestAttrsFromContext(t *testing.T) {
+
+	ctx := context.Background()
+	if attrs := appinsights.AttrsFromContext(ctx); attrs != nil {
+		t.Errorf("unexpected attributes: %v", attrs)
+	}
+
+	parent := appinsights.ContextWithAttrs(ctx, slog.Int("a", 1))
+	child1 := appinsights.ContextWithAttrs(parent, slog.Int("b", 2))
+	child2 := appinsights.ContextWithAttrs(parent, slog.Int("c", 3))
+
+	if attrs := appinsights.AttrsFromContext(child1); len(attrs) != 2 || attrs[1].Key != "b" {
+		t.Errorf("unexpected attributes: %v", attrs)
+	}
+	if attrs := appinsights.AttrsFromContext(child2); len(attrs) != 2 || attrs[1].Key != "c" {
+		t.Errorf("unexpected attributes: %v", attrs)
+	}
+	if appinsights.ContextWithAttrs(parent) != parent {
+		t.Error("context must not be derived without attributes")
+	}
+}
@@ -0,0 +1,83 @@
+package appinsights
+
+import (
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+)
+
+// modulePath is the path of this module.
+const modulePath = "github.com/openclosed-dev/slogan"
+
+// defaultRoleName returns the name of the running program,
+// which is the last element of the main package path if available.
+func defaultRoleName() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Path != "" {
+		return path.Base(info.Path)
+	}
+	if len(os.Args) > 0 {
+		return filepath.Base(os.Args[0])
+	}
+	return ""
+}
+
+// defaultRoleInstance returns the host name of the machine.
+func defaultRoleInstance() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
+
+// defaultApplicationVersion returns the version of the main module,
+// or an empty string if the program was not built from a versioned module.
+func defaultApplicationVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "(devel)" {
+		return ""
+	}
+	return info.Main.Version
+}
+
+// sdkVersion returns the name and the version of this module
+// reported as the SDK version of the telemetry.
+func sdkVersion() string {
+	version := "(devel)"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Path == modulePath {
+			version = info.Main.Version
+		}
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath {
+				version = dep.Version
+			}
+		}
+	}
+	return "slogan:" + version
+}
+
+// commonTags returns the context tags added to every telemetry item.
+func commonTags(opts *HandlerOptions) map[string]string {
+	tags := map[string]string{
+		internalSdkVersionTag: sdkVersion(),
+		deviceOSVersionTag:    runtime.GOOS,
+	}
+	if hostname := defaultRoleInstance(); hostname != "" {
+		tags[deviceIdTag] = hostname
+	}
+	if opts.RoleName != "" {
+		tags[cloudRoleTag] = opts.RoleName
+	}
+	if opts.RoleInstance != "" {
+		tags[cloudRoleInstanceTag] = opts.RoleInstance
+	}
+	if opts.ApplicationVersion != "" {
+		tags[applicationVersionTag] = opts.ApplicationVersion
+	}
+	maps.Copy(tags, opts.Tags)
+	return tags
+}
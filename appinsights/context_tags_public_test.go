@@ -0,0 +1,175 @@
+package appinsights_test
+
+import (
+	"log/slog"
+	"maps"
+	"os"
+	"testing"
+
+	"github.com/openclosed-dev/slogan/appinsights"
+)
+
+func TestRoleTags(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.RoleName = "frontend"
+	opts.RoleInstance = "frontend-1"
+	opts.ApplicationVersion = "v1.2.3"
+	opts.Tags = map[string]string{
+		"ai.device.type":        "PC",
+		"ai.cloud.roleInstance": "overridden",
+	}
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler)
+	logger.Info("message")
+
+	handler.Close()
+
+	item := server.getTelemetry()
+
+	expected := map[string]string{
+		"ai.cloud.role":         "frontend",
+		"ai.cloud.roleInstance": "overridden",
+		"ai.application.ver":    "v1.2.3",
+		"ai.device.type":        "PC",
+	}
+	for key, value := range expected {
+		if item.Tags[key] != value {
+			t.Errorf("expected tag %s is %s, but got %s", key, value, item.Tags[key])
+		}
+	}
+}
+
+func TestDefaultRoleTags(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.HandlerOptions{}
+	opts.Client = server.Client()
+
+	handler, err := appinsights.NewHandler(server.connectionString(), &opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler)
+	logger.Info("message")
+
+	handler.Close()
+
+	item := server.getTelemetry()
+
+	if role := item.Tags["ai.cloud.role"]; role != "appinsights.test" {
+		t.Errorf("unexpected role name: %s", role)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatalf("failed to get host name: %v", err)
+	}
+	if instance := item.Tags["ai.cloud.roleInstance"]; instance != hostname {
+		t.Errorf("unexpected role instance: %s", instance)
+	}
+}
+
+func TestTagAttributes(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.TagAttributes["http.device"] = "ai.device.type"
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler).With("user.id", "user-1", "session.id", "session-1")
+	logger.Info("message",
+		"enduser.id", "alice",
+		"client.address", "192.0.2.1",
+		slog.Group("http", "device", "Browser"),
+		"key1", "value1",
+	)
+	logger.Info("message", "user.id", "user-2")
+
+	handler.Close()
+
+	item := server.getTelemetry()
+
+	expected := map[string]string{
+		"ai.user.id":         "user-1",
+		"ai.user.authUserId": "alice",
+		"ai.session.id":      "session-1",
+		"ai.location.ip":     "192.0.2.1",
+		"ai.device.type":     "Browser",
+	}
+	for key, value := range expected {
+		if item.Tags[key] != value {
+			t.Errorf("expected tag %s is %s, but got %s", key, value, item.Tags[key])
+		}
+	}
+
+	expectedProperties := map[string]string{"key1": "value1"}
+	if !maps.Equal(item.properties(), expectedProperties) {
+		t.Errorf("unexpected properties: %v", item.properties())
+	}
+
+	item = server.getTelemetry()
+	if item.Tags["ai.user.id"] != "user-2" || item.Tags["ai.session.id"] != "session-1" {
+		t.Errorf("unexpected tags: %v", item.Tags)
+	}
+}
+
+func TestNoTagAttributes(t *testing.T) {
+
+	cases := []struct {
+		name          string
+		tagAttributes map[string]string
+	}{
+		{name: "nil", tagAttributes: nil},
+		{name: "empty", tagAttributes: map[string]string{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := newStubServer(8)
+			defer server.Close()
+
+			opts := appinsights.NewHandlerOptions(nil)
+			opts.Client = server.Client()
+			opts.TagAttributes = c.tagAttributes
+
+			handler, err := appinsights.NewHandler(server.connectionString(), opts)
+			if err != nil {
+				t.Fatalf("failed to create handler: %v", err)
+			}
+
+			logger := slog.New(handler)
+			logger.Info("message", "user.id", "user-1")
+
+			handler.Close()
+
+			item := server.getTelemetry()
+
+			if _, found := item.Tags["ai.user.id"]; found {
+				t.Error("attribute must not be mapped to tag")
+			}
+			if item.properties()["user.id"] != "user-1" {
+				t.Errorf("unexpected properties: %v", item.properties())
+			}
+		})
+	}
+}
@@ -2,17 +2,28 @@ package appinsights
 
 import (
 	"fmt"
+	"sync/atomic"
 	"time"
-
-	"github.com/microsoft/ApplicationInsights-Go/appinsights"
 )
 
+var diagnostics atomic.Bool
+
 // EnableDiagnostics enables telemetry printing for debugging purpose.
 func EnableDiagnostics() {
-	appinsights.NewDiagnosticsMessageListener(printDiagnosticsMessage)
+	diagnostics.Store(true)
+}
+
+func diagnosticsEnabled() bool {
+	return diagnostics.Load()
+}
+
+// diagnosticsf prints the formatted message if the diagnostics is enabled.
+func diagnosticsf(format string, args ...any) {
+	if diagnosticsEnabled() {
+		printDiagnosticsMessage(fmt.Sprintf(format, args...))
+	}
 }
 
-func printDiagnosticsMessage(message string) error {
+func printDiagnosticsMessage(message string) {
 	fmt.Printf("[%s] %s\n", time.Now().Format(time.RFC3339), message)
-	return nil
 }
@@ -0,0 +1,130 @@
+package appinsights
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"time"
+)
+
+// defaultKeySeparator separates the group names and the key of an attribute.
+const defaultKeySeparator = "."
+
+// GroupEncoding determines how the attributes in a group are submitted.
+type GroupEncoding int
+
+const (
+	// FlattenGroups submits each attribute in a group as a property
+	// whose key is qualified by the group names, such as "group1.key1".
+	FlattenGroups GroupEncoding = iota
+	// JSONGroups submits each outermost group as a property
+	// whose value is a JSON object of the attributes in the group,
+	// which can be parsed by parse_json in KQL.
+	JSONGroups
+)
+
+// ValueEncoding determines how the values of [slog.KindAny] are submitted.
+type ValueEncoding int
+
+const (
+	// FormatValues formats the values in the same way as [slog.Value.String].
+	FormatValues ValueEncoding = iota
+	// JSONValues marshals the values into JSON,
+	// which encodes []byte as a base64 string.
+	// Errors are submitted as their messages,
+	// and the values which cannot be marshaled are formatted as [FormatValues].
+	JSONValues
+)
+
+// formatValue returns the property value of the attribute value.
+func formatValue(v slog.Value, encoding ValueEncoding) string {
+	switch v.Kind() {
+	case slog.KindTime:
+		return v.Time().UTC().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		if encoding == JSONValues {
+			if raw, ok := marshalAny(v.Any()); ok {
+				var s string
+				if json.Unmarshal(raw, &s) == nil {
+					// without quotes
+					return s
+				}
+				return string(raw)
+			}
+		}
+		return v.String()
+	default:
+		return v.String()
+	}
+}
+
+// jsonValueOf returns the attribute value to be marshaled in a JSON group.
+func jsonValueOf(v slog.Value, encoding ValueEncoding) any {
+	switch v.Kind() {
+	case slog.KindString:
+		return v.String()
+	case slog.KindInt64:
+		return v.Int64()
+	case slog.KindUint64:
+		return v.Uint64()
+	case slog.KindFloat64:
+		if f := v.Float64(); !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f
+		}
+		return v.String()
+	case slog.KindBool:
+		return v.Bool()
+	case slog.KindAny:
+		if encoding == JSONValues {
+			if raw, ok := marshalAny(v.Any()); ok {
+				return raw
+			}
+		}
+		return formatValue(v, encoding)
+	default:
+		return formatValue(v, encoding)
+	}
+}
+
+// marshalAny marshals the value into JSON and reports whether it succeeded.
+// An error which does not implement [json.Marshaler] is marshaled as its message.
+func marshalAny(v any) (json.RawMessage, bool) {
+	if err, ok := v.(error); ok {
+		if _, ok := v.(json.Marshaler); !ok {
+			v = err.Error()
+		}
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	return raw, true
+}
+
+// setGroupValue sets the value at the path of the groups in the tree of JSON groups.
+func setGroupValue(tree map[string]any, groups []string, key string, value any) {
+	for _, g := range groups {
+		sub, ok := tree[g].(map[string]any)
+		if !ok {
+			sub = make(map[string]any)
+			tree[g] = sub
+		}
+		tree = sub
+	}
+	tree[key] = value
+}
+
+// cloneGroupValues returns a deep copy of the tree of JSON groups.
+func cloneGroupValues(tree map[string]any) map[string]any {
+	if tree == nil {
+		return nil
+	}
+	cloned := make(map[string]any, len(tree))
+	for key, value := range tree {
+		if sub, ok := value.(map[string]any); ok {
+			value = cloneGroupValues(sub)
+		}
+		cloned[key] = value
+	}
+	return cloned
+}
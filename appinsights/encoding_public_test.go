@@ -0,0 +1,122 @@
+package appinsights_test
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/openclosed-dev/slogan/appinsights"
+)
+
+func TestJSONGroups(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.GroupEncoding = appinsights.JSONGroups
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler).With("app", "test").WithGroup("request").With("id", 42)
+	logger.Info("message",
+		slog.Group("user", "name", "alice", "admin", true),
+		"ratio", 0.5,
+	)
+
+	handler.Close()
+
+	props := server.getTelemetry().properties()
+
+	if props["app"] != "test" {
+		t.Errorf("unexpected app property: %s", props["app"])
+	}
+	expected := `{"id":42,"ratio":0.5,"user":{"admin":true,"name":"alice"}}`
+	if props["request"] != expected {
+		t.Errorf("unexpected request property: %s", props["request"])
+	}
+	if len(props) != 2 {
+		t.Errorf("unexpected properties: %v", props)
+	}
+}
+
+func TestKeySeparator(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.KeySeparator = "_"
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler).WithGroup("request")
+	logger.Info("message", slog.Group("user", "name", "alice"))
+
+	handler.Close()
+
+	props := server.getTelemetry().properties()
+	if props["request_user_name"] != "alice" {
+		t.Errorf("unexpected properties: %v", props)
+	}
+}
+
+func TestJSONValues(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	type point struct {
+		X int `json:"x"`
+		Y int `json:"y"`
+	}
+
+	cases := []struct {
+		name     string
+		encoding appinsights.ValueEncoding
+		value    any
+		expected string
+	}{
+		{"struct", appinsights.JSONValues, point{1, 2}, `{"x":1,"y":2}`},
+		{"slice", appinsights.JSONValues, []string{"a", "b"}, `["a","b"]`},
+		{"map", appinsights.JSONValues, map[string]int{"a": 1}, `{"a":1}`},
+		{"bytes", appinsights.JSONValues, []byte{1, 2, 3}, "AQID"},
+		{"error", appinsights.JSONValues, errors.New("failure"), "failure"},
+		{"not marshalable", appinsights.JSONValues, func() {}, ""},
+		{"formatted struct", appinsights.FormatValues, point{1, 2}, "{1 2}"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			opts := appinsights.NewHandlerOptions(nil)
+			opts.Client = server.Client()
+			opts.ValueEncoding = c.encoding
+
+			handler, err := appinsights.NewHandler(server.connectionString(), opts)
+			if err != nil {
+				t.Fatalf("failed to create handler: %v", err)
+			}
+
+			slog.New(handler).Info("message", "key1", c.value)
+
+			handler.Close()
+
+			value, found := server.getTelemetry().properties()["key1"]
+			if !found {
+				t.Fatal("property is missing")
+			}
+			if c.expected != "" && value != c.expected {
+				t.Errorf("expected %s, but got %s", c.expected, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package appinsights
+
+import (
+	"time"
+	"unicode/utf8"
+)
+
+// Keys of the context tags of a telemetry item.
+const (
+	applicationVersionTag = "ai.application.ver"
+	deviceIdTag           = "ai.device.id"
+	deviceOSVersionTag    = "ai.device.osVersion"
+	operationIdTag        = "ai.operation.id"
+	operationNameTag      = "ai.operation.name"
+	operationParentIdTag  = "ai.operation.parentId"
+	cloudRoleTag          = "ai.cloud.role"
+	cloudRoleInstanceTag  = "ai.cloud.roleInstance"
+	internalSdkVersionTag = "ai.internal.sdkVersion"
+)
+
+// severityLevel is the severity level of a trace or an exception telemetry.
+type severityLevel int
+
+const (
+	severityVerbose severityLevel = iota
+	severityInformation
+	severityWarning
+	severityError
+	severityCritical
+)
+
+// Maximum lengths of the fields accepted by Application Insights.
+const (
+	maxMessageLength        = 32768
+	maxNameLength           = 512
+	maxTypeNameLength       = 1024
+	maxPropertyKeyLength    = 150
+	maxPropertyValueLength  = 8192
+	maxMeasurementKeyLength = 150
+)
+
+// dataVersion is the schema version of the telemetry data.
+const dataVersion = 2
+
+// envelopeTimeFormat is the format of the timestamp in an envelope.
+const envelopeTimeFormat = "2006-01-02T15:04:05.999999Z"
+
+// envelope is a telemetry item submitted to the ingestion endpoint.
+type envelope struct {
+	Name string `json:"name"`
+	Time string `json:"time"`
+	IKey string `json:"iKey"`
+	// SampleRate is the percentage of the telemetry being submitted,
+	// which is omitted if the telemetry is not sampled.
+	SampleRate float64           `json:"sampleRate,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	Data       envelopeData      `json:"data"`
+}
+
+type envelopeData struct {
+	BaseType string        `json:"baseType"`
+	BaseData telemetryData `json:"baseData"`
+}
+
+// telemetryData is the data specific to each type of telemetry.
+type telemetryData interface {
+	// baseType returns the type name of the data, such as "MessageData".
+	baseType() string
+	// envelopeName returns the last part of the envelope name, such as "Message".
+	envelopeName() string
+	// sanitize applies the limits of Application Insights to the fields
+	// and returns the number of the fields truncated or dropped.
+	sanitize(policy OverflowPolicy) int
+	// redact masks the sensitive parts of the message and the property values.
+	redact(r *redactor)
+}
+
+// messageData is the data of a trace telemetry.
+type messageData struct {
+	Ver           int                `json:"ver"`
+	Message       string             `json:"message"`
+	SeverityLevel severityLevel      `json:"severityLevel"`
+	Properties    map[string]string  `json:"properties,omitempty"`
+	Measurements  map[string]float64 `json:"measurements,omitempty"`
+}
+
+func (d *messageData) baseType() string {
+	return "MessageData"
+}
+
+func (d *messageData) envelopeName() string {
+	return "Message"
+}
+
+func (d *messageData) redact(r *redactor) {
+	d.Message = r.redact(d.Message)
+	r.redactValues(d.Properties)
+}
+
+func (d *messageData) sanitize(policy OverflowPolicy) int {
+	l := fieldLimiter{policy: policy}
+	d.Message = l.truncate(d.Message, maxMessageLength)
+	l.limitProperties(d.Properties)
+	l.limitMeasurements(d.Measurements)
+	return l.count
+}
+
+// eventData is the data of a custom event telemetry.
+type eventData struct {
+	Ver          int                `json:"ver"`
+	Name         string             `json:"name"`
+	Properties   map[string]string  `json:"properties,omitempty"`
+	Measurements map[string]float64 `json:"measurements,omitempty"`
+}
+
+func (d *eventData) baseType() string {
+	return "EventData"
+}
+
+func (d *eventData) envelopeName() string {
+	return "Event"
+}
+
+func (d *eventData) redact(r *redactor) {
+	r.redactValues(d.Properties)
+}
+
+func (d *eventData) sanitize(policy OverflowPolicy) int {
+	l := fieldLimiter{policy: policy}
+	d.Name = l.truncate(d.Name, maxNameLength)
+	l.limitProperties(d.Properties)
+	l.limitMeasurements(d.Measurements)
+	return l.count
+}
+
+// exceptionData is the data of an exception telemetry.
+type exceptionData struct {
+	Ver           int                 `json:"ver"`
+	Exceptions    []*exceptionDetails `json:"exceptions"`
+	SeverityLevel severityLevel       `json:"severityLevel"`
+	Properties    map[string]string   `json:"properties,omitempty"`
+	Measurements  map[string]float64  `json:"measurements,omitempty"`
+}
+
+// exceptionDetails is an exception in the chain of an exception telemetry.
+type exceptionDetails struct {
+	Id           int    `json:"id"`
+	OuterId      int    `json:"outerId"`
+	TypeName     string `json:"typeName"`
+	Message      string `json:"message"`
+	HasFullStack bool   `json:"hasFullStack"`
+}
+
+func (d *exceptionData) baseType() string {
+	return "ExceptionData"
+}
+
+func (d *exceptionData) envelopeName() string {
+	return "Exception"
+}
+
+func (d *exceptionData) redact(r *redactor) {
+	for _, e := range d.Exceptions {
+		e.Message = r.redact(e.Message)
+	}
+	r.redactValues(d.Properties)
+}
+
+func (d *exceptionData) sanitize(policy OverflowPolicy) int {
+	l := fieldLimiter{policy: policy}
+	for _, e := range d.Exceptions {
+		e.TypeName = l.truncate(e.TypeName, maxTypeNameLength)
+		e.Message = l.truncate(e.Message, maxMessageLength)
+	}
+	l.limitProperties(d.Properties)
+	l.limitMeasurements(d.Measurements)
+	return l.count
+}
+
+func newEnvelope(iKey, nameIKey string, t time.Time, data telemetryData) *envelope {
+	return &envelope{
+		Name: "Microsoft.ApplicationInsights." + nameIKey + "." + data.envelopeName(),
+		Time: t.UTC().Format(envelopeTimeFormat),
+		IKey: iKey,
+		Data: envelopeData{
+			BaseType: data.baseType(),
+			BaseData: data,
+		},
+	}
+}
+
+// truncate shortens s to at most n characters.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// exceedsLength reports whether s has more than n characters.
+func exceedsLength(s string, n int) bool {
+	return len(s) > n && utf8.RuneCountInString(s) > n
+}
@@ -0,0 +1,29 @@
+package appinsights
+
+import "log/slog"
+
+// EventKey is the key of the attribute created by [Event].
+const EventKey = "event"
+
+// eventName is the type of the value created by [Event].
+type eventName string
+
+// Event returns an attribute which causes the record to be submitted
+// as a custom event with the given name instead of a trace.
+// The other attributes of the record become the properties and the measurements
+// of the event, and the message of the record is added as a property.
+// The attribute may also be given to [slog.Logger.With]
+// so that all records logged by the logger become events.
+func Event(name string) slog.Attr {
+	return slog.Any(EventKey, eventName(name))
+}
+
+// eventNameOf returns the event name carried by the value,
+// or an empty string if the value was not created by [Event].
+func eventNameOf(v slog.Value) string {
+	if v.Kind() != slog.KindAny {
+		return ""
+	}
+	name, _ := v.Any().(eventName)
+	return string(name)
+}
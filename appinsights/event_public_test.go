@@ -0,0 +1,98 @@
+package appinsights_test
+
+import (
+	"errors"
+	"log/slog"
+	"maps"
+	"testing"
+
+	"github.com/openclosed-dev/slogan/appinsights"
+)
+
+func TestLogEvent(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler)
+	logger.Info("item purchased",
+		appinsights.Event("Purchase"),
+		"item", "book",
+		appinsights.Measurement("price", 12.5),
+	)
+
+	handler.Close()
+
+	item := server.getTelemetry()
+
+	if item.Data.BaseType != "EventData" {
+		t.Fatalf("unexpected base type: %s", item.Data.BaseType)
+	}
+	if item.Data.BaseData.Name != "Purchase" {
+		t.Errorf("unexpected event name: %s", item.Data.BaseData.Name)
+	}
+
+	expectedProperties := map[string]string{
+		"msg":  "item purchased",
+		"item": "book",
+	}
+	if actual := item.properties(); !maps.Equal(actual, expectedProperties) {
+		t.Errorf("expected properties are %v, but got %v", expectedProperties, actual)
+	}
+
+	expectedMeasurements := map[string]float64{
+		"price": 12.5,
+	}
+	if actual := item.measurements(); !maps.Equal(actual, expectedMeasurements) {
+		t.Errorf("expected measurements are %v, but got %v", expectedMeasurements, actual)
+	}
+}
+
+func TestLogEventWithAttrs(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.ExceptionLevel = slog.LevelError
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler)
+	events := logger.With(appinsights.Event("Failure")).WithGroup("group1")
+	events.Error("failed", "error", errors.New("failure"))
+	logger.Info("not an event")
+
+	handler.Close()
+
+	items := server.telemetryItems()
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items, but got %d", len(items))
+	}
+
+	if items[0].Data.BaseType != "EventData" {
+		t.Errorf("unexpected base type: %s", items[0].Data.BaseType)
+	}
+	if items[0].Data.BaseData.Name != "Failure" {
+		t.Errorf("unexpected event name: %s", items[0].Data.BaseData.Name)
+	}
+	if items[0].properties()["group1.error"] != "failure" {
+		t.Errorf("unexpected properties: %v", items[0].properties())
+	}
+
+	if items[1].Data.BaseType != "MessageData" {
+		t.Errorf("unexpected base type: %s", items[1].Data.BaseType)
+	}
+}
@@ -0,0 +1,98 @@
+package appinsights
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+)
+
+// maxExceptionDepth is the maximum depth of the errors in an exception chain,
+// which stops walking the errors unwrapping themselves.
+const maxExceptionDepth = 16
+
+// maxExceptionCount is the maximum number of the errors in an exception chain.
+const maxExceptionCount = 64
+
+// exceptionChain flattens the tree of errors built by
+// errors.Unwrap and errors.Join into a list of exception details.
+// The outermost error comes first and
+// each inner error refers to its parent by outerId.
+// The errors deeper than maxExceptionDepth are omitted.
+func exceptionChain(err error) []*exceptionDetails {
+	var list []*exceptionDetails
+
+	var walk func(err error, outerId, depth int)
+	walk = func(err error, outerId, depth int) {
+		if isNilError(err) || depth >= maxExceptionDepth || len(list) >= maxExceptionCount {
+			return
+		}
+		details := &exceptionDetails{
+			Id:       len(list) + 1,
+			OuterId:  outerId,
+			TypeName: reflect.TypeOf(err).String(),
+			Message:  errorMessage(err),
+		}
+		list = append(list, details)
+
+		switch u := err.(type) {
+		case interface{ Unwrap() error }:
+			walk(unwrap(u.Unwrap), details.Id, depth+1)
+		case interface{ Unwrap() []error }:
+			for _, inner := range unwrap(u.Unwrap) {
+				walk(inner, details.Id, depth+1)
+			}
+		}
+	}
+
+	walk(err, 0, 0)
+
+	return list
+}
+
+// errorMessage returns the message of the error.
+// A panic in the Error method is formatted in the same way as fmt does.
+func errorMessage(err error) string {
+	return fmt.Sprint(err)
+}
+
+// unwrap calls the Unwrap method of an error,
+// which returns the zero value if the method panics.
+func unwrap[T any](f func() T) (inner T) {
+	defer func() {
+		if recover() != nil {
+			var zero T
+			inner = zero
+		}
+	}()
+	return f()
+}
+
+// isNilError reports whether the error is nil
+// or a nil pointer or any other nil value of a type implementing error.
+func isNilError(err error) bool {
+	if err == nil {
+		return true
+	}
+	v := reflect.ValueOf(err)
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
+
+// errorOf returns the error carried by the attribute,
+// or nil if the attribute does not have an error value
+// or the error is a nil value of a type implementing error.
+func errorOf(a slog.Attr) error {
+	v := a.Value.Resolve()
+	if v.Kind() != slog.KindAny {
+		return nil
+	}
+	err, _ := v.Any().(error)
+	if isNilError(err) {
+		return nil
+	}
+	return err
+}
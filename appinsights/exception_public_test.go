@@ -0,0 +1,254 @@
+package appinsights_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/openclosed-dev/slogan/appinsights"
+)
+
+func TestLogErrorAsException(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.ExceptionLevel = slog.LevelError
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	cause := errors.New("connection refused")
+	wrapped := fmt.Errorf("failed to query: %w", cause)
+
+	logger := slog.New(handler)
+	logger.Error("request failed", "error", wrapped, "count", 3)
+
+	handler.Close()
+
+	item := server.getTelemetry()
+
+	if item.Data.BaseType != "ExceptionData" {
+		t.Fatalf("unexpected base type: %s", item.Data.BaseType)
+	}
+
+	data := &item.Data.BaseData
+	if data.SeverityLevel != 3 {
+		t.Errorf("incorrect level: %d", data.SeverityLevel)
+	}
+
+	exceptions := data.Exceptions
+	if len(exceptions) != 2 {
+		t.Fatalf("expected 2 exceptions, but got %d", len(exceptions))
+	}
+
+	if exceptions[0].Message != "failed to query: connection refused" {
+		t.Errorf("unexpected message: %s", exceptions[0].Message)
+	}
+	if exceptions[0].TypeName != "*fmt.wrapError" {
+		t.Errorf("unexpected type name: %s", exceptions[0].TypeName)
+	}
+	if exceptions[1].Message != "connection refused" {
+		t.Errorf("unexpected message: %s", exceptions[1].Message)
+	}
+	if exceptions[1].OuterId != exceptions[0].Id {
+		t.Errorf("inner exception does not refer to outer one: %d", exceptions[1].OuterId)
+	}
+
+	props := item.properties()
+	if props["msg"] != "request failed" {
+		t.Errorf("unexpected message property: %s", props["msg"])
+	}
+	if props["error"] != wrapped.Error() {
+		t.Errorf("unexpected error property: %s", props["error"])
+	}
+	if props["count"] != "3" {
+		t.Errorf("unexpected count property: %s", props["count"])
+	}
+}
+
+func TestLogJoinedErrorAsException(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.ExceptionLevel = slog.LevelError
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	joined := errors.Join(errors.New("first"), errors.New("second"))
+
+	logger := slog.New(handler)
+	logger.Log(context.Background(), appinsights.LevelCritical, "request failed", "error", joined)
+
+	handler.Close()
+
+	item := server.getTelemetry()
+
+	exceptions := item.Data.BaseData.Exceptions
+	if len(exceptions) != 3 {
+		t.Fatalf("expected 3 exceptions, but got %d", len(exceptions))
+	}
+
+	for i, message := range []string{"first", "second"} {
+		inner := exceptions[i+1]
+		if inner.Message != message {
+			t.Errorf("unexpected message: %s", inner.Message)
+		}
+		if inner.OuterId != exceptions[0].Id {
+			t.Errorf("inner exception does not refer to outer one: %d", inner.OuterId)
+		}
+	}
+}
+
+func TestLogErrorBelowExceptionLevel(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	cases := []struct {
+		name           string
+		exceptionLevel slog.Leveler
+		level          slog.Level
+	}{
+		{"disabled", nil, slog.LevelError},
+		{"below level", slog.LevelError, slog.LevelWarn},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			opts := appinsights.NewHandlerOptions(nil)
+			opts.Client = server.Client()
+			opts.ExceptionLevel = c.exceptionLevel
+
+			handler, err := appinsights.NewHandler(server.connectionString(), opts)
+			if err != nil {
+				t.Fatalf("failed to create handler: %v", err)
+			}
+
+			logger := slog.New(handler)
+			logger.Log(context.Background(), c.level, "request failed", "error", errors.New("failure"))
+
+			handler.Close()
+
+			item := server.getTelemetry()
+
+			if item.Data.BaseType != "MessageData" {
+				t.Errorf("unexpected base type: %s", item.Data.BaseType)
+			}
+			if item.properties()["error"] != "failure" {
+				t.Errorf("unexpected error property: %s", item.properties()["error"])
+			}
+		})
+	}
+}
+
+type nilReceiverError struct{ message string }
+
+func (e *nilReceiverError) Error() string {
+	return e.message
+}
+
+type cyclicError struct{}
+
+func (e *cyclicError) Error() string {
+	return "cyclic"
+}
+
+func (e *cyclicError) Unwrap() error {
+	return e
+}
+
+func TestLogUnusualErrorsAsException(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.ExceptionLevel = slog.LevelError
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	var nilErr *nilReceiverError
+
+	logger := slog.New(handler)
+	logger.Error("nil error", "error", error(nilErr))
+	logger.Error("cyclic error", "error", &cyclicError{})
+	logger.Error("wrapped nil error", "error", fmt.Errorf("failed: %w", nilErr))
+
+	handler.Close()
+
+	item := server.getTelemetry()
+	if item.Data.BaseType != "MessageData" {
+		t.Errorf("nil error must not be submitted as exception: %s", item.Data.BaseType)
+	}
+
+	item = server.getTelemetry()
+	if item.Data.BaseType != "ExceptionData" {
+		t.Fatalf("unexpected base type: %s", item.Data.BaseType)
+	}
+	if n := len(item.Data.BaseData.Exceptions); n == 0 || n > 16 {
+		t.Errorf("unexpected number of exceptions: %d", n)
+	}
+
+	item = server.getTelemetry()
+	exceptions := item.Data.BaseData.Exceptions
+	if len(exceptions) != 1 {
+		t.Fatalf("expected 1 exception, but got %d", len(exceptions))
+	}
+	if !strings.HasPrefix(exceptions[0].Message, "failed: ") {
+		t.Errorf("unexpected message: %s", exceptions[0].Message)
+	}
+}
+
+func TestLogErrorGivenByWithAttrsAsException(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.ExceptionLevel = slog.LevelError
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler).With("error", errors.New("connection refused")).WithGroup("group1")
+	logger.Error("request failed")
+	logger.Info("request retried")
+
+	handler.Close()
+
+	item := server.getTelemetry()
+	if item.Data.BaseType != "ExceptionData" {
+		t.Fatalf("unexpected base type: %s", item.Data.BaseType)
+	}
+	exceptions := item.Data.BaseData.Exceptions
+	if len(exceptions) != 1 || exceptions[0].Message != "connection refused" {
+		t.Errorf("unexpected exceptions: %+v", exceptions)
+	}
+
+	item = server.getTelemetry()
+	if item.Data.BaseType != "MessageData" {
+		t.Errorf("unexpected base type: %s", item.Data.BaseType)
+	}
+}
@@ -0,0 +1,170 @@
+package appinsights
+
+import (
+	"fmt"
+	"maps"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// OverflowPolicy determines how a property value
+// exceeding the limit of Application Insights is submitted.
+type OverflowPolicy int
+
+const (
+	// TruncateOverflow truncates the value and appends "..." to it.
+	TruncateOverflow OverflowPolicy = iota
+	// SplitOverflow splits the value into the properties
+	// "key", "key#2", "key#3" and so on.
+	SplitOverflow
+)
+
+// truncationMarker is appended to the truncated values.
+const truncationMarker = "..."
+
+// maxPropertyCount is the maximum number of the custom properties of a telemetry item.
+const maxPropertyCount = 200
+
+// unknownCallSite is the call site of the records without the source code position.
+const unknownCallSite = "unknown"
+
+// truncationCounter counts the fields truncated or dropped
+// for each call site of the log statements.
+type truncationCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *truncationCounter) add(pc uintptr, count int) {
+	site := callSite(pc)
+	diagnosticsf("Truncated %d fields of the record logged at %s", count, site)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[string]int)
+	}
+	c.counts[site] += count
+}
+
+func (c *truncationCounter) snapshot() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.counts)
+}
+
+// callSite returns the source code position of the log statement as "file:line".
+func callSite(pc uintptr) string {
+	if pc == 0 {
+		return unknownCallSite
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	if frame.File == "" {
+		return unknownCallSite
+	}
+	return frame.File + ":" + strconv.Itoa(frame.Line)
+}
+
+// fieldLimiter applies the limits of Application Insights to the fields
+// of a telemetry item and counts the fields truncated or dropped.
+type fieldLimiter struct {
+	policy OverflowPolicy
+	count  int
+}
+
+// truncate truncates the field exceeding n characters and appends the marker to it.
+func (l *fieldLimiter) truncate(s string, n int) string {
+	if !exceedsLength(s, n) {
+		return s
+	}
+	l.count++
+	return truncate(s, n-len(truncationMarker)) + truncationMarker
+}
+
+// limitProperties applies the limits to the properties.
+// The values exceeding the limit are truncated or split according to the policy,
+// and the properties exceeding the maximum count are dropped in the order of the keys.
+func (l *fieldLimiter) limitProperties(properties map[string]string) {
+	if len(properties) == 0 {
+		return
+	}
+
+	original := maps.Clone(properties)
+	clear(properties)
+
+	for _, key := range slices.Sorted(maps.Keys(original)) {
+		value := original[key]
+		if exceedsLength(key, maxPropertyKeyLength) {
+			key = truncateKey(key, maxPropertyKeyLength, func(k string) bool {
+				_, taken := properties[k]
+				return taken
+			})
+			l.count++
+		}
+		if exceedsLength(value, maxPropertyValueLength) && l.policy == SplitOverflow {
+			l.count++
+			for i, part := range splitValue(value, maxPropertyValueLength) {
+				properties[splitKey(key, i)] = part
+			}
+		} else {
+			properties[key] = l.truncate(value, maxPropertyValueLength)
+		}
+	}
+
+	if excess := len(properties) - maxPropertyCount; excess > 0 {
+		for _, key := range slices.Sorted(maps.Keys(properties))[maxPropertyCount:] {
+			delete(properties, key)
+		}
+		l.count += excess
+	}
+}
+
+// limitMeasurements truncates the keys of the measurements exceeding the limit.
+func (l *fieldLimiter) limitMeasurements(measurements map[string]float64) {
+	for _, key := range slices.Sorted(maps.Keys(measurements)) {
+		if exceedsLength(key, maxMeasurementKeyLength) {
+			value := measurements[key]
+			delete(measurements, key)
+			key = truncateKey(key, maxMeasurementKeyLength, func(k string) bool {
+				_, taken := measurements[k]
+				return taken
+			})
+			measurements[key] = value
+			l.count++
+		}
+	}
+}
+
+// splitValue splits s into the parts of at most n characters.
+func splitValue(s string, n int) []string {
+	var parts []string
+	for exceedsLength(s, n) {
+		part := truncate(s, n)
+		parts = append(parts, part)
+		s = s[len(part):]
+	}
+	return append(parts, s)
+}
+
+// splitKey returns the key of the i-th part of a split value.
+func splitKey(key string, i int) string {
+	if i == 0 {
+		return key
+	}
+	suffix := fmt.Sprintf("#%d", i+1)
+	return truncate(key, maxPropertyKeyLength-len(suffix)) + suffix
+}
+
+// truncateKey truncates the key to n characters.
+// If the truncated key is already taken by another field,
+// "~2", "~3" and so on are appended to it so that no value is overwritten.
+func truncateKey(key string, n int, taken func(string) bool) string {
+	truncated := truncate(key, n)
+	for i := 2; taken(truncated); i++ {
+		suffix := fmt.Sprintf("~%d", i)
+		truncated = truncate(key, n-len(suffix)) + suffix
+	}
+	return truncated
+}
@@ -0,0 +1,164 @@
+package appinsights_test
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/openclosed-dev/slogan/appinsights"
+)
+
+func TestTruncateOverflow(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler)
+	logger.Info("message", "key1", strings.Repeat("a", 10000), strings.Repeat("k", 200), "value")
+
+	handler.Close()
+
+	props := server.getTelemetry().properties()
+
+	value := props["key1"]
+	if len(value) != 8192 || !strings.HasSuffix(value, "...") {
+		t.Errorf("value was not truncated: %d", len(value))
+	}
+	if props[strings.Repeat("k", 150)] != "value" {
+		t.Errorf("key was not truncated: %v", props)
+	}
+
+	counts := handler.TruncationCounts()
+	if len(counts) != 1 {
+		t.Fatalf("unexpected truncation counts: %v", counts)
+	}
+	for site, count := range counts {
+		if !strings.Contains(site, "field_limits_public_test.go:") {
+			t.Errorf("unexpected call site: %s", site)
+		}
+		if count != 2 {
+			t.Errorf("expected 2 truncated fields, but got %d", count)
+		}
+	}
+}
+
+func TestSplitOverflow(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.OverflowPolicy = appinsights.SplitOverflow
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	value := strings.Repeat("a", 8192) + strings.Repeat("b", 8192) + "c"
+
+	logger := slog.New(handler)
+	logger.Info("message", "key1", value)
+
+	handler.Close()
+
+	props := server.getTelemetry().properties()
+
+	if props["key1"]+props["key1#2"]+props["key1#3"] != value {
+		t.Errorf("value was not split: %d, %d, %d",
+			len(props["key1"]), len(props["key1#2"]), len(props["key1#3"]))
+	}
+}
+
+func TestMaxPropertyCount(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	var args []any
+	for i := range 250 {
+		args = append(args, fmt.Sprintf("key%03d", i), i)
+	}
+
+	logger := slog.New(handler)
+	logger.Info("message", args...)
+
+	handler.Close()
+
+	props := server.getTelemetry().properties()
+	if len(props) != 200 {
+		t.Errorf("expected 200 properties, but got %d", len(props))
+	}
+	if _, found := props["key199"]; !found {
+		t.Errorf("first properties were dropped")
+	}
+
+	var total int
+	for _, count := range handler.TruncationCounts() {
+		total += count
+	}
+	if total != 50 {
+		t.Errorf("expected 50 dropped properties, but got %d", total)
+	}
+}
+
+func TestLimitsInCharacters(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	longKey := strings.Repeat("鍵", 150)
+
+	logger := slog.New(handler)
+	logger.Info("message",
+		"fits", strings.Repeat("値", 8192),
+		"overflows", strings.Repeat("値", 8193),
+		longKey+"1", "value1",
+		longKey+"2", "value2",
+	)
+
+	handler.Close()
+
+	props := server.getTelemetry().properties()
+
+	if value := props["fits"]; utf8.RuneCountInString(value) != 8192 || strings.HasSuffix(value, "...") {
+		t.Errorf("value must not be truncated: %d", utf8.RuneCountInString(value))
+	}
+	if value := props["overflows"]; utf8.RuneCountInString(value) != 8192 || !strings.HasSuffix(value, "...") {
+		t.Errorf("value was not truncated: %d", utf8.RuneCountInString(value))
+	}
+
+	values := []string{props[longKey], props[strings.Repeat("鍵", 148)+"~2"]}
+	slices.Sort(values)
+	if !slices.Equal(values, []string{"value1", "value2"}) {
+		t.Errorf("truncated keys must not overwrite each other: %v", props)
+	}
+}
@@ -0,0 +1,91 @@
+package appinsights
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"strings"
+)
+
+// groupLevelsEnv is the environment variable which overrides [HandlerOptions.GroupLevels].
+const groupLevelsEnv = "SLOGAN_GROUP_LEVELS"
+
+// parseGroupLevels parses the group levels in the format of "db=WARN,billing=DEBUG".
+func parseGroupLevels(s string) (map[string]slog.Leveler, error) {
+	levels := make(map[string]slog.Leveler)
+	for _, entry := range strings.Split(s, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		group, value, found := strings.Cut(entry, "=")
+		group = strings.TrimSpace(group)
+		if !found || group == "" {
+			return nil, fmt.Errorf("group level has no group: %q", entry)
+		}
+		level, err := parseLevel(value)
+		if err != nil {
+			return nil, fmt.Errorf("group level of %s is invalid: %w", group, err)
+		}
+		levels[group] = level
+	}
+	return levels, nil
+}
+
+// applyGroupLevelsEnv merges the group levels given by the environment variable
+// into the options, which take precedence over those in the options.
+func applyGroupLevelsEnv(opts *HandlerOptions) error {
+	value := os.Getenv(groupLevelsEnv)
+	if value == "" {
+		return nil
+	}
+	levels, err := parseGroupLevels(value)
+	if err != nil {
+		return fmt.Errorf("environment variable %s is invalid: %w", groupLevelsEnv, err)
+	}
+	merged := maps.Clone(opts.GroupLevels)
+	if merged == nil {
+		merged = make(map[string]slog.Leveler, len(levels))
+	}
+	maps.Copy(merged, levels)
+	opts.GroupLevels = merged
+	return nil
+}
+
+// levelFor returns the leveler of the records logged in the groups by the component.
+// The leveler is resolved when a handler is derived
+// so that Enabled does not need to look up the group levels.
+func levelFor(opts *HandlerOptions, groups []string, component string) slog.Leveler {
+	level := opts.Level
+	if groupLevel, found := lookupGroupLevel(opts.GroupLevels, groups); found {
+		level = groupLevel
+	} else if groupLevel, found := opts.GroupLevels[component]; found && component != "" {
+		level = groupLevel
+	}
+
+	if controller, ok := opts.Level.(*LevelController); ok {
+		return controller.forGroups(groups, level)
+	}
+	return level
+}
+
+// lookupGroupLevel returns the level of the longest group path matching the groups.
+func lookupGroupLevel(levels map[string]slog.Leveler, groups []string) (slog.Leveler, bool) {
+	if len(levels) == 0 || len(groups) == 0 {
+		return nil, false
+	}
+	for group := strings.Join(groups, groupSeparator); group != ""; group = parentGroup(group) {
+		if level, found := levels[group]; found {
+			return level, true
+		}
+	}
+	return nil, false
+}
+
+// parentGroup returns the path of the parent group, which is empty for a top-level group.
+func parentGroup(group string) string {
+	if i := strings.LastIndex(group, groupSeparator); i >= 0 {
+		return group[:i]
+	}
+	return ""
+}
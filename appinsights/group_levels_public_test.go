@@ -0,0 +1,115 @@
+package appinsights_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/openclosed-dev/slogan/appinsights"
+)
+
+func TestGroupLevels(t *testing.T) {
+
+	opts := appinsights.NewHandlerOptions(slog.LevelInfo)
+	opts.GroupLevels = map[string]slog.Leveler{
+		"db":      slog.LevelWarn,
+		"db.tx":   slog.LevelDebug,
+		"billing": slog.LevelDebug,
+	}
+	opts.ComponentKey = "component"
+
+	handler, err := appinsights.NewHandler("InstrumentationKey="+instrumentationKey, opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	ctx := context.Background()
+	billing := handler.WithAttrs([]slog.Attr{slog.String("component", "billing")})
+
+	tests := []struct {
+		name    string
+		handler slog.Handler
+		enabled slog.Level
+	}{
+		{"root", handler, slog.LevelInfo},
+		{"group", handler.WithGroup("db"), slog.LevelWarn},
+		{"nested group", handler.WithGroup("db").WithGroup("query"), slog.LevelWarn},
+		{"longest group", handler.WithGroup("db").WithGroup("tx"), slog.LevelDebug},
+		{"other group", handler.WithGroup("cache"), slog.LevelInfo},
+		{"component", billing, slog.LevelDebug},
+		{"component in group", billing.WithGroup("db"), slog.LevelWarn},
+		{"other component", handler.WithAttrs([]slog.Attr{slog.String("component", "auth")}), slog.LevelInfo},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !test.handler.Enabled(ctx, test.enabled) {
+				t.Errorf("level %v must be enabled", test.enabled)
+			}
+			if test.handler.Enabled(ctx, test.enabled-1) {
+				t.Errorf("level %v must be disabled", test.enabled-1)
+			}
+		})
+	}
+}
+
+func TestGroupLevelsFromEnv(t *testing.T) {
+
+	t.Setenv("SLOGAN_GROUP_LEVELS", "db=ERROR, billing=debug")
+
+	opts := appinsights.NewHandlerOptions(slog.LevelInfo)
+	opts.GroupLevels = map[string]slog.Leveler{"db": slog.LevelWarn}
+
+	handler, err := appinsights.NewHandler("InstrumentationKey="+instrumentationKey, opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	ctx := context.Background()
+	if db := handler.WithGroup("db"); db.Enabled(ctx, slog.LevelWarn) || !db.Enabled(ctx, slog.LevelError) {
+		t.Error("the environment variable must take precedence")
+	}
+	if !handler.WithGroup("billing").Enabled(ctx, slog.LevelDebug) {
+		t.Error("debug level must be enabled in the group")
+	}
+	if opts.GroupLevels["db"] != slog.LevelWarn {
+		t.Error("options must not be modified")
+	}
+}
+
+func TestGroupLevelsFromInvalidEnv(t *testing.T) {
+
+	t.Setenv("SLOGAN_GROUP_LEVELS", "db=LOUD")
+
+	_, err := appinsights.NewHandler("InstrumentationKey="+instrumentationKey, nil)
+	if err == nil {
+		t.Error("error must be returned")
+	}
+}
+
+func TestGroupLevelsWithLevelController(t *testing.T) {
+
+	controller := appinsights.NewLevelController(slog.LevelInfo)
+
+	opts := appinsights.NewHandlerOptions(controller)
+	opts.GroupLevels = map[string]slog.Leveler{"db": slog.LevelWarn}
+
+	handler, err := appinsights.NewHandler("InstrumentationKey="+instrumentationKey, opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	ctx := context.Background()
+	db := handler.WithGroup("db")
+	if db.Enabled(ctx, slog.LevelInfo) {
+		t.Error("info level must be disabled in the group")
+	}
+
+	controller.SetGroupLevel("db", slog.LevelDebug, 0)
+	if !db.Enabled(ctx, slog.LevelDebug) {
+		t.Error("the level changed at runtime must take precedence")
+	}
+}
@@ -2,13 +2,14 @@ package appinsights
 
 import (
 	"context"
+	"encoding/json"
 	"log/slog"
 	"maps"
 	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
 	"time"
-
-	"github.com/microsoft/ApplicationInsights-Go/appinsights"
-	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
 )
 
 const (
@@ -24,13 +25,28 @@ const (
 	ingestionEndpointPath   = "/v2/track"
 	defaultMaxBatchSize     = 1024
 	defaultMaxBatchInterval = time.Duration(10) * time.Second
+	defaultCloseTimeout     = 30 * time.Second
 )
 
 // HandlerOptions are options for a [Handler].
 type HandlerOptions struct {
 	// Level reports the minimum record level that will be logged.
+	// A [*LevelController] allows to change the level at runtime,
+	// optionally for particular groups.
 	// Default value is [slog.LevelInfo].
 	Level slog.Leveler
+	// GroupLevels are the minimum record levels for particular groups or components,
+	// keyed by the paths of the group names separated by periods,
+	// such as "db" or "db.query", or by the component names.
+	// The level of the longest path matching the groups given by WithGroup
+	// takes precedence, followed by the level of the component.
+	// The environment variable SLOGAN_GROUP_LEVELS in the format of
+	// "db=WARN,billing=DEBUG" adds to or overrides these levels.
+	GroupLevels map[string]slog.Leveler
+	// ComponentKey is the key of the attribute given to WithAttrs
+	// which names the component for GroupLevels, such as "component".
+	// The level is not determined by the component if this is empty.
+	ComponentKey string
 	// MaxBatchSize is the maximum number of log records.
 	// that can be submitted in a request.
 	MaxBatchSize int
@@ -38,17 +54,158 @@ type HandlerOptions struct {
 	MaxBatchInterval time.Duration
 	// Client is a customized HTTP client.
 	Client *http.Client
+	// ExceptionLevel reports the minimum record level
+	// at which a record carrying an error attribute is submitted
+	// as an exception telemetry instead of a trace telemetry.
+	// Exception telemetry is disabled if this is nil.
+	ExceptionLevel slog.Leveler
+	// OperationExtractor returns the operation
+	// which the record logged with the given context belongs to.
+	// Default value is [OperationFromContext].
+	OperationExtractor func(context.Context) (Operation, bool)
+	// ContextExtractors return the request-scoped attributes
+	// carried by the context given to the handler, such as a tenant ID.
+	// The attributes are added to every record before its own attributes,
+	// outside of the groups given by WithGroup.
+	// Default value is a slice of [AttrsFromContext] if this is nil,
+	// and an empty slice extracts no attributes.
+	ContextExtractors []func(context.Context) []slog.Attr
+	// AddSource causes the handler to add the properties
+	// "source.function", "source.file" and "source.line"
+	// which tell the source code position of the log statement.
+	AddSource bool
+	// ReplaceAttr is called to rewrite each non-group attribute before it is added
+	// to the properties of the telemetry, in the same way as [slog.HandlerOptions].
+	// The attribute's value has been resolved.
+	// If ReplaceAttr returns a zero Attr, the attribute is discarded.
+	//
+	// The first argument is a list of currently open groups that contain the
+	// Attr. It must not be retained or modified.
+	// The attribute of the source code position has the key [slog.SourceKey]
+	// and is passed with a nil list of groups.
+	ReplaceAttr func(groups []string, a slog.Attr) slog.Attr
+	// MeasurementPolicy determines which numeric attributes are submitted
+	// as custom measurements instead of custom properties.
+	// Default value is [MeasureMarked].
+	MeasurementPolicy MeasurementPolicy
+	// MeasurementKeys are the keys of the attributes submitted as custom measurements
+	// when MeasurementPolicy is [MeasureListedKeys].
+	// A key of an attribute in a group must be qualified by the group names
+	// separated by KeySeparator, such as "group1.key1".
+	MeasurementKeys []string
+	// RoleName is the name of the cloud role shown in the Application Map.
+	// Default value is the name of the running program.
+	RoleName string
+	// RoleInstance is the name of the cloud role instance.
+	// Default value is the host name of the machine.
+	RoleInstance string
+	// ApplicationVersion is the version of the application.
+	// Default value is the version of the main module if available.
+	ApplicationVersion string
+	// Tags are the context tags added to every telemetry item,
+	// such as "ai.device.type".
+	// These take precedence over the tags set by the fields above.
+	Tags map[string]string
+	// TagAttributes maps the keys of the attributes to the context tags
+	// such as "ai.user.id" and "ai.session.id",
+	// which the attributes are submitted as instead of custom properties.
+	// A key of an attribute in a group must be qualified by the group names
+	// separated by KeySeparator.
+	// [NewHandlerOptions] sets this to [DefaultTagAttributes],
+	// and nil maps no attributes.
+	TagAttributes map[string]string
+	// StorageDir is the directory where the batches of log records
+	// are stored when they cannot be transmitted,
+	// and from which they are transmitted again once the endpoint is available.
+	// The directory may be shared by multiple processes and handlers,
+	// each of which stores the batches in the subdirectory
+	// named after its instrumentation key and ingestion endpoint,
+	// so that the batches are transmitted only to the resource they belong to.
+	// The records are kept only in memory if this is empty.
+	StorageDir string
+	// StorageMaxSize is the maximum total size in bytes of the stored batches
+	// of each resource.
+	// Batches are discarded while the storage is full.
+	// Default value is 50 MiB.
+	StorageMaxSize int64
+	// StorageMaxAge is the maximum age of the stored batches.
+	// Older batches are discarded without being transmitted.
+	// Default value is 48 hours.
+	StorageMaxAge time.Duration
+	// OnError is called with a [*TransmissionError]
+	// whenever log records are dropped without being delivered,
+	// for example, when the ingestion endpoint rejected them,
+	// or when retries were exhausted.
+	// It is called from a background goroutine one call at a time,
+	// so it may log through the handler itself.
+	// The records dropped while the submission is throttled
+	// are reported together when the throttling ends,
+	// and the records logged after the handler was closed
+	// are not reported while OnError is running.
+	OnError func(err error, droppedCount int)
+	// TokenProvider provides the access tokens of Microsoft Entra ID
+	// attached to the requests to the ingestion endpoint,
+	// which are required when the local authentication of the resource is disabled.
+	// The scope of the tokens is derived from AADAudience of the connection string.
+	// The records rejected with the status 401 or 403 are retried with a new token.
+	TokenProvider TokenProvider
+	// OverflowPolicy determines how a property value exceeding
+	// the limit of Application Insights, 8192 characters, is submitted.
+	// The other fields exceeding the limits are always truncated,
+	// and the properties exceeding the maximum count of 200 are dropped.
+	// Default value is [TruncateOverflow].
+	OverflowPolicy OverflowPolicy
+	// RedactionRules determine the sensitive data masked before submission,
+	// which are applied before the limits of the fields.
+	// Nothing is masked if this is empty.
+	// See [DefaultRedactionRules] for the rules masking the common sensitive data.
+	RedactionRules []RedactionRule
+	// GroupEncoding determines how the attributes in a group are submitted.
+	// Default value is [FlattenGroups].
+	GroupEncoding GroupEncoding
+	// KeySeparator separates the group names and the key of an attribute
+	// in the flattened keys of the properties and the measurements.
+	// Default value is ".".
+	KeySeparator string
+	// ValueEncoding determines how the values of [slog.KindAny] are submitted.
+	// Default value is [FormatValues].
+	ValueEncoding ValueEncoding
+	// Sampler decides which log records are submitted
+	// to reduce the volume of telemetry.
+	// All records are submitted if this is nil.
+	Sampler Sampler
+	// SamplingExemptLevel reports the minimum record level
+	// at which records are always submitted regardless of Sampler.
+	// Default value is [slog.LevelWarn].
+	SamplingExemptLevel slog.Leveler
 }
 
 // Handler is a [slog.Handler] that submits log records to
 // Azure Application Insights.
 type Handler struct {
 	opts   *HandlerOptions
-	client appinsights.TelemetryClient
+	client *telemetryClient
 	level  slog.Leveler
-	// keyPrefix is empty or otherwise ends with period.
+	// redactor masks the sensitive data, which is nil if there are no rules.
+	redactor *redactor
+	// keyPrefix is empty or otherwise ends with the key separator.
 	keyPrefix  string
+	groups     []string
 	attributes map[string]string
+	// groupValues are the attributes in the groups encoded as JSON.
+	groupValues map[string]any
+	// measurements are the attributes submitted as custom measurements.
+	measurements map[string]float64
+	// tags are the context tags given by WithAttrs.
+	tags map[string]string
+	// err is the first error value given by WithAttrs.
+	err error
+	// event is the name of the custom event given by WithAttrs.
+	event string
+	// component is the name of the component given by WithAttrs.
+	component string
+	// derived is true if the handler was created by WithAttrs or WithGroup.
+	derived bool
 }
 
 // NewHandlerOptions creates a [HandlerOptions]
@@ -58,9 +215,19 @@ func NewHandlerOptions(level slog.Leveler) *HandlerOptions {
 		level = defaultLogLevel
 	}
 	return &HandlerOptions{
-		Level:            level,
-		MaxBatchSize:     defaultMaxBatchSize,
-		MaxBatchInterval: defaultMaxBatchInterval,
+		Level:               level,
+		MaxBatchSize:        defaultMaxBatchSize,
+		MaxBatchInterval:    defaultMaxBatchInterval,
+		OperationExtractor:  OperationFromContext,
+		ContextExtractors:   defaultContextExtractors(),
+		RoleName:            defaultRoleName(),
+		RoleInstance:        defaultRoleInstance(),
+		ApplicationVersion:  defaultApplicationVersion(),
+		TagAttributes:       DefaultTagAttributes(),
+		StorageMaxSize:      defaultStorageMaxSize,
+		StorageMaxAge:       defaultStorageMaxAge,
+		SamplingExemptLevel: defaultSamplingExemptLevel,
+		KeySeparator:        defaultKeySeparator,
 	}
 }
 
@@ -72,18 +239,33 @@ func NewHandlerOptions(level slog.Leveler) *HandlerOptions {
 // or may be nil if the default settings are sufficient.
 func NewHandler(connectionString string, opts *HandlerOptions) (*Handler, error) {
 
-	var params, err = parseConnectionString(connectionString)
+	cs, err := ParseConnectionString(connectionString)
 	if err != nil {
 		return nil, err
 	}
 
 	opts = fillHandlerOptions(opts)
+	if err := applyGroupLevelsEnv(opts); err != nil {
+		return nil, err
+	}
+
+	redactor, err := newRedactor(opts.RedactionRules)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newTelemetryClient(cs, opts)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Handler{
-		opts:       opts,
-		client:     newTelemetryClient(params, opts),
-		level:      opts.Level,
-		attributes: make(map[string]string),
+		opts:         opts,
+		client:       client,
+		level:        levelFor(opts, nil, ""),
+		redactor:     redactor,
+		attributes:   make(map[string]string),
+		measurements: make(map[string]float64),
 	}, nil
 }
 
@@ -94,22 +276,107 @@ func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
 }
 
 // Handle handles the log Record.
-func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+// A record at or above [HandlerOptions.ExceptionLevel] which has
+// an error attribute is submitted as an exception telemetry,
+// whose properties also include the message of the record.
+// A record which has an attribute created by [Event] is submitted
+// as a custom event in preference to an exception.
+// The operation found in ctx is stamped on the submitted telemetry,
+// and the attributes extracted from ctx by [HandlerOptions.ContextExtractors]
+// are added to the record.
+// The attributes mapped by [HandlerOptions.TagAttributes] are submitted as context tags.
+// A record may be dropped by [HandlerOptions.Sampler].
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+
+	op, _ := h.opts.OperationExtractor(ctx)
+	if op.ID == "" {
+		op.ID = newOperationID()
+	}
 
-	item := appinsights.NewTraceTelemetry(r.Message, mapLogLevel(r.Level))
+	sampleRate, sampled := h.sample(op.ID, r.Level)
+	if !sampled {
+		return nil
+	}
+
+	properties := make(map[string]string, len(h.attributes)+r.NumAttrs())
+	maps.Copy(properties, h.attributes)
+
+	w := attrWriter{
+		opts:         h.opts,
+		redactor:     h.redactor,
+		properties:   properties,
+		measurements: maps.Clone(h.measurements),
+		groupValues:  cloneGroupValues(h.groupValues),
+		tags:         cloneTags(h.tags),
+		captureError: h.exceptionEnabled(r.Level),
+		event:        h.event,
+	}
+	if w.captureError {
+		w.err = h.err
+	}
 
-	if !r.Time.IsZero() {
-		item.Timestamp = r.Time
+	if h.opts.AddSource && r.PC != 0 {
+		w.writeSource(r.PC)
 	}
 
-	maps.Copy(item.Properties, h.attributes)
+	for _, extract := range h.opts.ContextExtractors {
+		for _, a := range extract(ctx) {
+			w.writeAttr("", nil, a)
+		}
+	}
 
 	r.Attrs(func(a slog.Attr) bool {
-		addAttributeToMap(item.Properties, h.keyPrefix, a)
+		w.writeAttr(h.keyPrefix, h.groups, a)
 		return true
 	})
 
-	h.client.Track(item)
+	w.writeGroupValues()
+
+	var data telemetryData
+	if w.event != "" {
+		addMessageToProperties(properties, r.Message)
+		data = &eventData{
+			Ver:          dataVersion,
+			Name:         w.event,
+			Properties:   properties,
+			Measurements: w.measurements,
+		}
+	} else if err := w.err; err != nil {
+		addMessageToProperties(properties, r.Message)
+		data = &exceptionData{
+			Ver:           dataVersion,
+			Exceptions:    exceptionChain(err),
+			SeverityLevel: mapLogLevel(r.Level),
+			Properties:    properties,
+			Measurements:  w.measurements,
+		}
+	} else {
+		data = &messageData{
+			Ver:           dataVersion,
+			Message:       r.Message,
+			SeverityLevel: mapLogLevel(r.Level),
+			Properties:    properties,
+			Measurements:  w.measurements,
+		}
+	}
+
+	t := r.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	if h.redactor != nil {
+		data.redact(h.redactor)
+		h.redactor.redactValues(w.tags)
+	}
+
+	if truncated := data.sanitize(h.opts.OverflowPolicy); truncated > 0 {
+		h.client.truncations.add(r.PC, truncated)
+	}
+
+	addOperationToTags(w.tags, op)
+
+	h.client.track(t, data, w.tags, sampleRate)
 
 	return nil
 }
@@ -128,15 +395,60 @@ func (h *Handler) WithGroup(name string) slog.Handler {
 	return h.withGroup(name)
 }
 
-// Close flushes the buffered log records
-// and waits until the transmission is complete.
-func (h *Handler) Close() {
+// Flush submits the buffered log records immediately
+// and waits until the transmission of the records handled so far is complete
+// or ctx is done, without shutting down the handler.
+// The records not delivered are reported to [HandlerOptions.OnError].
+func (h *Handler) Flush(ctx context.Context) error {
 	if client := h.client; client != nil {
-		select {
-		case <-client.Channel().Close(10 * time.Second):
-		case <-time.After(30 * time.Second):
-		}
+		return client.flush(ctx)
+	}
+	return nil
+}
+
+// Shutdown flushes the buffered log records
+// and waits until the transmission is complete or ctx is done.
+// If any log record was not delivered while shutting down,
+// it returns a [*TransmissionError] reporting those records.
+// Shutdown called on a handler derived by WithAttrs or WithGroup
+// is equivalent to [Handler.Flush], and does not shut down its siblings
+// sharing the connection; only the handler created by [NewHandler] does.
+func (h *Handler) Shutdown(ctx context.Context) error {
+	client := h.client
+	if client == nil {
+		return nil
+	}
+	if h.derived {
+		return client.flush(ctx)
+	}
+	return client.shutdown(ctx)
+}
+
+// Close is equivalent to [Handler.Shutdown] with the timeout of 30 seconds.
+func (h *Handler) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCloseTimeout)
+	defer cancel()
+	return h.Shutdown(ctx)
+}
+
+// ThrottlingStats returns the statistics of the throttling by the ingestion endpoint,
+// which are shared by all handlers derived from the same handler.
+func (h *Handler) ThrottlingStats() ThrottlingStats {
+	if client := h.client; client != nil {
+		return client.channel.throttle.stats()
+	}
+	return ThrottlingStats{}
+}
+
+// TruncationCounts returns the number of the fields truncated or dropped
+// to meet the limits of Application Insights, keyed by the source code position
+// "file:line" of the log statements, which are shared by all handlers
+// derived from the same handler.
+func (h *Handler) TruncationCounts() map[string]int {
+	if client := h.client; client != nil {
+		return client.truncations.snapshot()
 	}
+	return nil
 }
 
 func fillHandlerOptions(opts *HandlerOptions) *HandlerOptions {
@@ -144,102 +456,259 @@ func fillHandlerOptions(opts *HandlerOptions) *HandlerOptions {
 		return NewHandlerOptions(defaultLogLevel)
 	}
 
-	var level slog.Leveler
-	if opts.Level != nil {
-		level = opts.Level
-	} else {
-		level = defaultLogLevel
+	filled := *opts
+
+	if filled.Level == nil {
+		filled.Level = defaultLogLevel
 	}
 
-	var maxBatchSize int
-	if opts.MaxBatchSize > 0 {
-		maxBatchSize = opts.MaxBatchSize
-	} else {
-		maxBatchSize = defaultMaxBatchSize
+	if filled.MaxBatchSize <= 0 {
+		filled.MaxBatchSize = defaultMaxBatchSize
 	}
 
-	var maxBatchInterval time.Duration
-	if opts.MaxBatchInterval > 0 {
-		maxBatchInterval = opts.MaxBatchInterval
-	} else {
-		maxBatchInterval = defaultMaxBatchInterval
+	if filled.MaxBatchInterval <= 0 {
+		filled.MaxBatchInterval = defaultMaxBatchInterval
 	}
 
-	return &HandlerOptions{
-		level,
-		maxBatchSize,
-		maxBatchInterval,
-		opts.Client,
+	if filled.OperationExtractor == nil {
+		filled.OperationExtractor = OperationFromContext
+	}
+
+	if filled.ContextExtractors == nil {
+		filled.ContextExtractors = defaultContextExtractors()
+	}
+
+	if filled.StorageMaxSize <= 0 {
+		filled.StorageMaxSize = defaultStorageMaxSize
+	}
+
+	if filled.StorageMaxAge <= 0 {
+		filled.StorageMaxAge = defaultStorageMaxAge
+	}
+
+	if filled.KeySeparator == "" {
+		filled.KeySeparator = defaultKeySeparator
 	}
-}
 
-func newTelemetryClient(params *connectionParams, opts *HandlerOptions) appinsights.TelemetryClient {
+	if filled.SamplingExemptLevel == nil {
+		filled.SamplingExemptLevel = defaultSamplingExemptLevel
+	}
+
+	if filled.RoleName == "" {
+		filled.RoleName = defaultRoleName()
+	}
+
+	if filled.RoleInstance == "" {
+		filled.RoleInstance = defaultRoleInstance()
+	}
+
+	if filled.ApplicationVersion == "" {
+		filled.ApplicationVersion = defaultApplicationVersion()
+	}
+
+	return &filled
+}
 
-	var endpointUrl = *params.ingestionEndpoint
-	endpointUrl.Path = ingestionEndpointPath
+// addMessageToProperties adds the message of the record to the properties
+// of the telemetry which has no field for the message.
+func addMessageToProperties(properties map[string]string, message string) {
+	if _, found := properties[slog.MessageKey]; !found && message != "" {
+		properties[slog.MessageKey] = message
+	}
+}
 
-	var config = appinsights.TelemetryConfiguration{
-		InstrumentationKey: params.instrumentationKey,
-		EndpointUrl:        endpointUrl.String(),
-		MaxBatchSize:       opts.MaxBatchSize,
-		MaxBatchInterval:   opts.MaxBatchInterval,
-		Client:             opts.Client,
+// sample reports whether the record is submitted
+// and returns the percentage of the records being submitted.
+func (h *Handler) sample(operationID string, level slog.Level) (float64, bool) {
+	sampler := h.opts.Sampler
+	if sampler == nil || level >= h.opts.SamplingExemptLevel.Level() {
+		return 100, true
 	}
+	sampled, percentage := sampler.Sample(operationID, level)
+	return percentage, sampled
+}
 
-	return appinsights.NewTelemetryClientFromConfig(&config)
+func (h *Handler) exceptionEnabled(level slog.Level) bool {
+	exceptionLevel := h.opts.ExceptionLevel
+	return exceptionLevel != nil && level >= exceptionLevel.Level()
 }
 
-func mapLogLevel(level slog.Level) contracts.SeverityLevel {
+func mapLogLevel(level slog.Level) severityLevel {
 	switch {
 	case level <= slog.LevelDebug:
-		return appinsights.Verbose
+		return severityVerbose
 	case level >= LevelCritical:
-		return appinsights.Critical
+		return severityCritical
 	case level >= slog.LevelError:
-		return appinsights.Error
+		return severityError
 	case level >= slog.LevelWarn:
-		return appinsights.Warning
+		return severityWarning
 	default:
-		return appinsights.Information
+		return severityInformation
+	}
+}
+
+// attrWriter writes attributes to the properties
+// and the measurements of a telemetry item.
+type attrWriter struct {
+	opts         *HandlerOptions
+	redactor     *redactor
+	properties   map[string]string
+	measurements map[string]float64
+	// groupValues are the attributes in the groups encoded as JSON,
+	// which are written to the properties by writeGroupValues.
+	groupValues map[string]any
+	// tags are the context tags mapped by TagAttributes.
+	tags map[string]string
+	// captureError enables to keep the first error value found in err.
+	captureError bool
+	err          error
+	// event is the name of the custom event given by Event.
+	event string
+}
+
+func (w *attrWriter) writeAttr(keyPrefix string, groups []string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if w.opts.ReplaceAttr != nil && a.Value.Kind() != slog.KindGroup {
+		a = w.opts.ReplaceAttr(groups, a)
+		a.Value = a.Value.Resolve()
 	}
+	w.writeValue(keyPrefix, groups, a)
 }
 
-func addAttributeToMap(m map[string]string, keyPrefix string, a slog.Attr) {
+func (w *attrWriter) writeValue(keyPrefix string, groups []string, a slog.Attr) {
 	if a.Equal(slog.Attr{}) {
 		return
 	}
 
-	var value string
+	if a.Value.Kind() != slog.KindGroup {
+		mask, found := w.redactor.maskOf(keyPrefix+a.Key, a.Key)
+		if !found {
+			mask, found = w.redactor.maskOfGroups(groups, w.opts.KeySeparator)
+		}
+		if found {
+			a.Value = slog.StringValue(mask(formatValue(a.Value, w.opts.ValueEncoding)))
+		}
+	}
 
-	a.Value = a.Value.Resolve()
+	if tag, found := w.opts.TagAttributes[keyPrefix+a.Key]; found && a.Value.Kind() != slog.KindGroup {
+		writeTag(w.tags, tag, a.Value)
+		return
+	}
+
+	if number, ok := w.measure(keyPrefix+a.Key, a.Value); ok {
+		w.measurements[keyPrefix+a.Key] = number
+		return
+	}
 
 	switch a.Value.Kind() {
-	case slog.KindTime:
-		value = a.Value.Time().UTC().Format(time.RFC3339Nano)
 	case slog.KindGroup:
-		addAttributeGroupToMap(m, keyPrefix, a)
+		w.writeGroup(keyPrefix, groups, a)
 		return
-	default:
-		value = a.Value.String()
+	case slog.KindAny:
+		if name := eventNameOf(a.Value); name != "" {
+			w.event = name
+			return
+		}
+		if w.captureError && w.err == nil {
+			w.err = errorOf(a)
+		}
+	}
+
+	value := formatValue(a.Value, w.opts.ValueEncoding)
+	if value == "" {
+		return
+	}
+
+	if w.opts.GroupEncoding == JSONGroups && len(groups) > 0 {
+		if w.groupValues == nil {
+			w.groupValues = make(map[string]any)
+		}
+		setGroupValue(w.groupValues, groups, a.Key, jsonValueOf(a.Value, w.opts.ValueEncoding))
+		return
+	}
+
+	w.properties[keyPrefix+a.Key] = value
+}
+
+// measure returns the number to be submitted as a custom measurement
+// and reports whether the value should be a measurement.
+func (w *attrWriter) measure(key string, v slog.Value) (float64, bool) {
+	number, ok := numberOf(v)
+	if !ok {
+		return 0, false
 	}
 
-	if value != "" {
-		m[keyPrefix+a.Key] = value
+	switch {
+	case v.Kind() == slog.KindAny:
+		// created by Measurement
+		return number, true
+	case w.opts.MeasurementPolicy == MeasureAllNumbers:
+		return number, true
+	case w.opts.MeasurementPolicy == MeasureListedKeys:
+		return number, slices.Contains(w.opts.MeasurementKeys, key)
+	default:
+		return 0, false
 	}
 }
 
-func addAttributeGroupToMap(m map[string]string, keyPrefix string, g slog.Attr) {
+func (w *attrWriter) writeGroup(keyPrefix string, groups []string, g slog.Attr) {
 	attrs := g.Value.Group()
 	if len(attrs) == 0 {
 		return
 	}
 
 	if g.Key != "" {
-		keyPrefix += g.Key + "."
+		keyPrefix += g.Key + w.opts.KeySeparator
+		groups = append(slices.Clip(groups), g.Key)
 	}
 
 	for _, a := range attrs {
-		addAttributeToMap(m, keyPrefix, a)
+		w.writeAttr(keyPrefix, groups, a)
+	}
+}
+
+// writeGroupValues writes each outermost group encoded as JSON to the properties.
+func (w *attrWriter) writeGroupValues() {
+	for key, value := range w.groupValues {
+		if encoded, err := json.Marshal(value); err == nil {
+			w.properties[key] = string(encoded)
+		}
+	}
+}
+
+// writeSource writes the source location of the program counter
+// as the properties named "source.function", "source.file" and "source.line".
+func (w *attrWriter) writeSource(pc uintptr) {
+	frames := runtime.CallersFrames([]uintptr{pc})
+	frame, _ := frames.Next()
+
+	a := slog.Any(slog.SourceKey, &slog.Source{
+		Function: frame.Function,
+		File:     frame.File,
+		Line:     frame.Line,
+	})
+
+	if w.opts.ReplaceAttr != nil {
+		a = w.opts.ReplaceAttr(nil, a)
+		a.Value = a.Value.Resolve()
+	}
+
+	source, ok := a.Value.Any().(*slog.Source)
+	if a.Value.Kind() != slog.KindAny || !ok || source == nil {
+		w.writeValue("", nil, a)
+		return
+	}
+
+	keyPrefix := a.Key + w.opts.KeySeparator
+	if source.Function != "" {
+		w.properties[keyPrefix+"function"] = source.Function
+	}
+	if source.File != "" {
+		w.properties[keyPrefix+"file"] = source.File
+	}
+	if source.Line != 0 {
+		w.properties[keyPrefix+"line"] = strconv.Itoa(source.Line)
 	}
 }
 
@@ -252,16 +721,47 @@ func (h *Handler) withAttrs(attrs []slog.Attr) *Handler {
 	newSize := len(h.attributes) + len(attrs)
 	newAttributes := make(map[string]string, newSize)
 	maps.Copy(newAttributes, h.attributes)
+	newMeasurements := maps.Clone(h.measurements)
+
+	w := attrWriter{
+		opts:         h.opts,
+		redactor:     h.redactor,
+		properties:   newAttributes,
+		measurements: newMeasurements,
+		groupValues:  cloneGroupValues(h.groupValues),
+		tags:         cloneTags(h.tags),
+		captureError: true,
+		err:          h.err,
+		event:        h.event,
+	}
+	component := h.component
 	for _, a := range attrs {
-		addAttributeToMap(newAttributes, h.keyPrefix, a)
+		w.writeAttr(h.keyPrefix, h.groups, a)
+		if key := h.opts.ComponentKey; key != "" && a.Key == key {
+			component = a.Value.Resolve().String()
+		}
+	}
+
+	level := h.level
+	if component != h.component {
+		level = levelFor(h.opts, h.groups, component)
 	}
 
 	return &Handler{
-		opts:       h.opts,
-		client:     h.client,
-		level:      h.level,
-		keyPrefix:  h.keyPrefix,
-		attributes: newAttributes,
+		opts:         h.opts,
+		client:       h.client,
+		level:        level,
+		redactor:     h.redactor,
+		keyPrefix:    h.keyPrefix,
+		groups:       h.groups,
+		attributes:   newAttributes,
+		groupValues:  w.groupValues,
+		measurements: newMeasurements,
+		tags:         w.tags,
+		err:          w.err,
+		event:        w.event,
+		component:    component,
+		derived:      true,
 	}
 }
 
@@ -271,13 +771,23 @@ func (h *Handler) withGroup(name string) *Handler {
 		return h
 	}
 
-	newKeyPrefix := h.keyPrefix + name + "."
+	newKeyPrefix := h.keyPrefix + name + h.opts.KeySeparator
+	newGroups := append(slices.Clip(h.groups), name)
 
 	return &Handler{
-		opts:       h.opts,
-		client:     h.client,
-		level:      h.level,
-		keyPrefix:  newKeyPrefix,
-		attributes: maps.Clone(h.attributes),
+		opts:         h.opts,
+		client:       h.client,
+		level:        levelFor(h.opts, newGroups, h.component),
+		redactor:     h.redactor,
+		keyPrefix:    newKeyPrefix,
+		groups:       newGroups,
+		attributes:   maps.Clone(h.attributes),
+		groupValues:  h.groupValues,
+		measurements: maps.Clone(h.measurements),
+		tags:         h.tags,
+		err:          h.err,
+		event:        h.event,
+		component:    h.component,
+		derived:      true,
 	}
 }
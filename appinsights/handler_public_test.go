@@ -4,11 +4,12 @@ import (
 	"context"
 	"log/slog"
 	"maps"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
-	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
 	"github.com/openclosed-dev/slogan/appinsights"
 )
 
@@ -28,12 +29,12 @@ func TestLogMessage(t *testing.T) {
 		name          string
 		level         slog.Level
 		message       string
-		severityLevel contracts.SeverityLevel
+		severityLevel severityLevel
 	}{
-		{"info", slog.LevelInfo, "info message", contracts.Information},
-		{"warn", slog.LevelWarn, "warn message", contracts.Warning},
-		{"error", slog.LevelError, "error message", contracts.Error},
-		{"debug", slog.LevelDebug, "debug message", contracts.Verbose},
+		{"info", slog.LevelInfo, "info message", severityInformation},
+		{"warn", slog.LevelWarn, "warn message", severityWarning},
+		{"error", slog.LevelError, "error message", severityError},
+		{"debug", slog.LevelDebug, "debug message", severityVerbose},
 		//
 		{"fatal", appinsights.LevelFatal, "fatal message", 4},
 		{"critical", appinsights.LevelCritical, "critical message", 4},
@@ -77,18 +78,18 @@ func TestLogLevel(t *testing.T) {
 
 	ctx := context.Background()
 
-	allLevels := [5]contracts.SeverityLevel{
-		contracts.Verbose,
-		contracts.Information,
-		contracts.Warning,
-		contracts.Error,
-		contracts.Critical,
+	allLevels := [5]severityLevel{
+		severityVerbose,
+		severityInformation,
+		severityWarning,
+		severityError,
+		severityCritical,
 	}
 
 	cases := []struct {
 		name     string
 		minLevel slog.Leveler
-		items    []contracts.SeverityLevel
+		items    []severityLevel
 	}{
 		{
 			"debug",
@@ -182,7 +183,7 @@ func TestHandlerOptionsWithDefaultValues(t *testing.T) {
 
 	data := items[0].Data.BaseData
 
-	if data.SeverityLevel != int(contracts.Information) {
+	if data.SeverityLevel != int(severityInformation) {
 		t.Errorf("unexpected severity level: %d", data.SeverityLevel)
 	}
 
@@ -439,7 +440,6 @@ func TestInvalidConnectionString(t *testing.T) {
 	}{
 		{"empty", "", "connection string is empty"},
 		{"missing instrumentation key", "IngestionEndpoint=https://example.org/", "instrumentation key is missing"},
-		{"missing ingestion endpoint", "InstrumentationKey=f81d4fae-7dec-11d0-a765-00a0c91e6bf6", "ingestion endpoint is missing"},
 		{"invalid ingestion endpoint", "InstrumentationKey=f81d4fae-7dec-11d0-a765-00a0c91e6bf6;IngestionEndpoint=://example.org", "ingestion endpoint is not a valid URL"},
 	}
 	for _, c := range cases {
@@ -454,3 +454,197 @@ func TestInvalidConnectionString(t *testing.T) {
 		})
 	}
 }
+
+func TestReplaceAttr(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	var groupsOfKey2 []string
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+		switch a.Key {
+		case "password":
+			return slog.String(a.Key, "***")
+		case "dropped":
+			return slog.Attr{}
+		case "key2":
+			groupsOfKey2 = slices.Clone(groups)
+			return slog.Int("renamed", 42)
+		}
+		return a
+	}
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler).With("password", "secret").WithGroup("group1")
+	logger.Info("message",
+		"key1", "hello",
+		"dropped", "value",
+		slog.Group("group2", "key2", 7),
+	)
+
+	handler.Close()
+
+	item := server.getTelemetry()
+
+	expected := map[string]string{
+		"password":              "***",
+		"group1.key1":           "hello",
+		"group1.group2.renamed": "42",
+	}
+
+	actual := item.properties()
+	if !maps.Equal(actual, expected) {
+		t.Errorf("expected attributes are %v, but got %v", expected, actual)
+	}
+
+	if !slices.Equal(groupsOfKey2, []string{"group1", "group2"}) {
+		t.Errorf("unexpected groups: %v", groupsOfKey2)
+	}
+}
+
+func TestAddSource(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.AddSource = true
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler)
+	logger.Info("message")
+
+	handler.Close()
+
+	item := server.getTelemetry()
+
+	props := item.properties()
+	if !strings.HasSuffix(props["source.function"], ".TestAddSource") {
+		t.Errorf("unexpected function: %s", props["source.function"])
+	}
+	if !strings.HasSuffix(props["source.file"], "handler_public_test.go") {
+		t.Errorf("unexpected file: %s", props["source.file"])
+	}
+	if props["source.line"] == "" {
+		t.Error("line is missing")
+	}
+}
+
+func TestAddSourceWithReplaceAttr(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.AddSource = true
+	opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+		if a.Key == slog.SourceKey && groups == nil {
+			source := a.Value.Any().(*slog.Source)
+			return slog.String("caller", filepath.Base(source.File))
+		}
+		return a
+	}
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler)
+	logger.Info("message")
+
+	handler.Close()
+
+	item := server.getTelemetry()
+
+	expected := map[string]string{
+		"caller": "handler_public_test.go",
+	}
+
+	actual := item.properties()
+	if !maps.Equal(actual, expected) {
+		t.Errorf("expected attributes are %v, but got %v", expected, actual)
+	}
+}
+
+func TestFlush(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.MaxBatchInterval = time.Hour
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	logger := slog.New(handler)
+
+	for _, message := range []string{"first", "second"} {
+		logger.Info(message)
+
+		if err := handler.Flush(context.Background()); err != nil {
+			t.Fatalf("failed to flush: %v", err)
+		}
+
+		items := server.telemetryItems()
+		if len(items) != 1 {
+			t.Fatalf("expected 1 record, but got %d", len(items))
+		}
+		if items[0].Data.BaseData.Message != message {
+			t.Errorf("unexpected message: %s", items[0].Data.BaseData.Message)
+		}
+	}
+}
+
+func TestShutdownDerivedHandler(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.MaxBatchInterval = time.Hour
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	derived := handler.WithAttrs([]slog.Attr{slog.String("key1", "value1")}).(*appinsights.Handler)
+	slog.New(derived).Info("derived")
+
+	if err := derived.Shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to shut down: %v", err)
+	}
+	if items := server.telemetryItems(); len(items) != 1 {
+		t.Fatalf("expected 1 record, but got %d", len(items))
+	}
+
+	// The sibling is still available.
+	slog.New(handler.WithGroup("group1")).Info("sibling")
+
+	if err := handler.Shutdown(context.Background()); err != nil {
+		t.Fatalf("failed to shut down: %v", err)
+	}
+	if item := server.getTelemetry(); item.Data.BaseData.Message != "sibling" {
+		t.Errorf("unexpected message: %s", item.Data.BaseData.Message)
+	}
+}
@@ -0,0 +1,288 @@
+package appinsights
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// groupSeparator separates the group names in the group paths of [LevelController].
+const groupSeparator = "."
+
+// LevelController is a [slog.Leveler] whose level can be changed at runtime,
+// optionally for the records logged in particular groups
+// and only for a limited time.
+// Pass it as [HandlerOptions.Level] to control the level of a [Handler]
+// and all handlers derived from it.
+//
+// LevelController also implements [http.Handler] for the administration:
+//
+//   - GET returns the current levels as a JSON object.
+//   - PUT or POST changes the level given by the query parameter or form value "level",
+//     such as "DEBUG" or "WARN+2", for the group path such as "db.query"
+//     given by the parameter "group", or for all records if the group is omitted.
+//     The level reverts after the duration given by the parameter "ttl",
+//     such as "15m", or never if it is omitted.
+//   - DELETE removes the level changed for the parameter "group",
+//     or all the levels changed if the group is omitted.
+//
+// The handler has no authentication and must not be exposed publicly.
+type LevelController struct {
+	// base is the level used when no override is effective.
+	base slog.Leveler
+
+	mu sync.RWMutex
+	// overrides are the levels keyed by the group paths,
+	// where the empty path applies to all records.
+	overrides map[string]levelOverride
+}
+
+// levelOverride is a level changed at runtime.
+type levelOverride struct {
+	level slog.Level
+	// expires is the time when the override reverts, or zero for no expiration.
+	expires time.Time
+}
+
+// levelState is the JSON representation of a level.
+type levelState struct {
+	Level   string     `json:"level"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// levelControllerState is the JSON representation of a [LevelController].
+type levelControllerState struct {
+	levelState
+	Groups map[string]levelState `json:"groups,omitempty"`
+}
+
+// NewLevelController creates a [LevelController] whose level is
+// the given level unless changed.
+// The level is [slog.LevelInfo] if nil.
+func NewLevelController(level slog.Leveler) *LevelController {
+	if level == nil {
+		level = defaultLogLevel
+	}
+	return &LevelController{
+		base:      level,
+		overrides: make(map[string]levelOverride),
+	}
+}
+
+// Level returns the level effective for the records not in any group.
+func (c *LevelController) Level() slog.Level {
+	return c.groupLevel("")
+}
+
+// SetLevel changes the level for all records.
+// The level reverts after ttl if it is positive.
+func (c *LevelController) SetLevel(level slog.Level, ttl time.Duration) {
+	c.SetGroupLevel("", level, ttl)
+}
+
+// SetGroupLevel changes the level for the records logged in the group,
+// which is the path of the group names separated by periods, such as "db.query".
+// The level also applies to the nested groups unless they have their own levels.
+// The level reverts after ttl if it is positive.
+func (c *LevelController) SetGroupLevel(group string, level slog.Level, ttl time.Duration) {
+	override := levelOverride{level: level}
+	if ttl > 0 {
+		override.expires = time.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.overrides[group] = override
+}
+
+// ResetGroupLevel removes the level changed for the group.
+// The empty group removes the level changed for all records.
+func (c *LevelController) ResetGroupLevel(group string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.overrides, group)
+}
+
+// Reset removes all the levels changed.
+func (c *LevelController) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.overrides)
+}
+
+// groupLevel returns the level effective for the group path.
+func (c *LevelController) groupLevel(group string) slog.Level {
+	if level, found := c.override(group); found {
+		return level
+	}
+	return c.base.Level()
+}
+
+// override returns the level changed for the group path.
+// The override of the longest matching path takes precedence.
+func (c *LevelController) override(group string) (slog.Level, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.overrides) == 0 {
+		return 0, false
+	}
+
+	now := time.Now()
+	for {
+		if override, found := c.overrides[group]; found && override.active(now) {
+			return override.level, true
+		}
+		if group == "" {
+			return 0, false
+		}
+		group = parentGroup(group)
+	}
+}
+
+// forGroups returns the leveler for the handler with the groups,
+// which falls back to the given leveler unless the level is changed.
+func (c *LevelController) forGroups(groups []string, fallback slog.Leveler) slog.Leveler {
+	if len(groups) == 0 && fallback == c {
+		return c
+	}
+	return &groupLeveler{
+		controller: c,
+		group:      strings.Join(groups, groupSeparator),
+		fallback:   fallback,
+	}
+}
+
+func (o levelOverride) active(now time.Time) bool {
+	return o.expires.IsZero() || now.Before(o.expires)
+}
+
+// groupLeveler is the leveler of the records logged in a group.
+type groupLeveler struct {
+	controller *LevelController
+	group      string
+	fallback   slog.Leveler
+}
+
+func (l *groupLeveler) Level() slog.Level {
+	if level, found := l.controller.override(l.group); found {
+		return level
+	}
+	return l.fallback.Level()
+}
+
+// ServeHTTP reads or changes the levels.
+func (c *LevelController) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPut, http.MethodPost:
+		if err := c.update(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		if err := req.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if group, found := req.Form["group"]; found {
+			c.ResetGroupLevel(group[0])
+		} else {
+			c.Reset()
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.state())
+}
+
+// update changes the level as requested.
+func (c *LevelController) update(req *http.Request) error {
+	if err := req.ParseForm(); err != nil {
+		return err
+	}
+
+	value := req.Form.Get("level")
+	if value == "" {
+		return errors.New("level is missing")
+	}
+	level, err := parseLevel(value)
+	if err != nil {
+		return err
+	}
+
+	var ttl time.Duration
+	if value := req.Form.Get("ttl"); value != "" {
+		ttl, err = time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("ttl is not a positive duration: %s", value)
+		}
+	}
+
+	c.SetGroupLevel(req.Form.Get("group"), level, ttl)
+	return nil
+}
+
+// state returns the current levels, excluding the expired ones.
+func (c *LevelController) state() levelControllerState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	state := levelControllerState{
+		levelState: levelState{Level: formatLevel(c.base.Level())},
+	}
+
+	for group, override := range c.overrides {
+		if !override.active(now) {
+			delete(c.overrides, group)
+			continue
+		}
+		s := levelState{Level: formatLevel(override.level)}
+		if !override.expires.IsZero() {
+			expires := override.expires.UTC()
+			s.Expires = &expires
+		}
+		if group == "" {
+			state.levelState = s
+		} else {
+			if state.Groups == nil {
+				state.Groups = make(map[string]levelState)
+			}
+			state.Groups[group] = s
+		}
+	}
+
+	return state
+}
+
+// parseLevel parses the name of a level such as "DEBUG" or "WARN+2" case-insensitively.
+// "CRITICAL" and "FATAL" are also accepted.
+func parseLevel(s string) (slog.Level, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "CRITICAL", "FATAL":
+		return LevelCritical, nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid level: %s", s)
+	}
+	return level, nil
+}
+
+// formatLevel returns the name of the level.
+func formatLevel(level slog.Level) string {
+	if level == LevelCritical {
+		return "CRITICAL"
+	}
+	return level.String()
+}
@@ -0,0 +1,136 @@
+package appinsights_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openclosed-dev/slogan/appinsights"
+)
+
+func TestLevelControllerChangesLevel(t *testing.T) {
+
+	controller := appinsights.NewLevelController(slog.LevelInfo)
+
+	opts := appinsights.NewHandlerOptions(controller)
+	handler, err := appinsights.NewHandler("InstrumentationKey="+instrumentationKey, opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	ctx := context.Background()
+	db := handler.WithGroup("db")
+	query := db.WithGroup("query").WithAttrs([]slog.Attr{slog.Int("id", 1)})
+
+	if handler.Enabled(ctx, slog.LevelDebug) {
+		t.Error("debug level must be disabled initially")
+	}
+
+	controller.SetGroupLevel("db", slog.LevelDebug, 0)
+
+	if handler.Enabled(ctx, slog.LevelDebug) {
+		t.Error("debug level must be disabled outside of the group")
+	}
+	if !db.Enabled(ctx, slog.LevelDebug) || !query.Enabled(ctx, slog.LevelDebug) {
+		t.Error("debug level must be enabled in the group")
+	}
+
+	controller.SetLevel(slog.LevelError, 0)
+	controller.SetGroupLevel("db.query", slog.LevelWarn, 0)
+
+	if handler.Enabled(ctx, slog.LevelWarn) {
+		t.Error("warn level must be disabled")
+	}
+	if query.Enabled(ctx, slog.LevelInfo) || !query.Enabled(ctx, slog.LevelWarn) {
+		t.Error("the level of the nested group must take precedence")
+	}
+
+	controller.Reset()
+
+	if !handler.Enabled(ctx, slog.LevelInfo) || db.Enabled(ctx, slog.LevelDebug) {
+		t.Error("levels were not reset")
+	}
+}
+
+func TestLevelControllerReverts(t *testing.T) {
+
+	controller := appinsights.NewLevelController(nil)
+	controller.SetLevel(slog.LevelDebug, 50*time.Millisecond)
+
+	if controller.Level() != slog.LevelDebug {
+		t.Errorf("unexpected level: %v", controller.Level())
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if controller.Level() != slog.LevelInfo {
+		t.Errorf("level did not revert: %v", controller.Level())
+	}
+}
+
+func TestLevelControllerServeHTTP(t *testing.T) {
+
+	controller := appinsights.NewLevelController(slog.LevelInfo)
+
+	type state struct {
+		Level   string     `json:"level"`
+		Expires *time.Time `json:"expires"`
+		Groups  map[string]struct {
+			Level   string     `json:"level"`
+			Expires *time.Time `json:"expires"`
+		} `json:"groups"`
+	}
+
+	serve := func(method, target string) (int, state) {
+		rec := httptest.NewRecorder()
+		controller.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		var s state
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+				t.Fatalf("failed to parse response: %v", err)
+			}
+		}
+		return rec.Code, s
+	}
+
+	code, s := serve(http.MethodPut, "/?level=debug&group=db&ttl=15m")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", code)
+	}
+	if s.Level != "INFO" {
+		t.Errorf("unexpected level: %s", s.Level)
+	}
+	if g := s.Groups["db"]; g.Level != "DEBUG" || g.Expires == nil {
+		t.Errorf("unexpected group level: %+v", g)
+	}
+
+	code, s = serve(http.MethodPost, "/?level=critical")
+	if code != http.StatusOK || s.Level != "CRITICAL" || s.Expires != nil {
+		t.Errorf("unexpected response: %d %+v", code, s)
+	}
+
+	code, s = serve(http.MethodDelete, "/?group=db")
+	if code != http.StatusOK || len(s.Groups) != 0 || s.Level != "CRITICAL" {
+		t.Errorf("unexpected response: %d %+v", code, s)
+	}
+
+	code, s = serve(http.MethodDelete, "/")
+	if code != http.StatusOK || s.Level != "INFO" {
+		t.Errorf("unexpected response: %d %+v", code, s)
+	}
+
+	if code, _ := serve(http.MethodPut, "/?level=verbose"); code != http.StatusBadRequest {
+		t.Errorf("unexpected status for invalid level: %d", code)
+	}
+	if code, _ := serve(http.MethodPut, "/?level=debug&ttl=-1m"); code != http.StatusBadRequest {
+		t.Errorf("unexpected status for invalid ttl: %d", code)
+	}
+	if code, _ := serve(http.MethodPatch, "/"); code != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status for unsupported method: %d", code)
+	}
+}
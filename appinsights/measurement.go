@@ -0,0 +1,62 @@
+package appinsights
+
+import (
+	"log/slog"
+	"math"
+	"time"
+)
+
+// MeasurementPolicy determines which attributes are submitted
+// as custom measurements instead of custom properties.
+type MeasurementPolicy int
+
+const (
+	// MeasureMarked submits only the attributes created by [Measurement]
+	// as custom measurements.
+	MeasureMarked MeasurementPolicy = iota
+	// MeasureListedKeys submits the numeric attributes whose keys are listed in
+	// [HandlerOptions.MeasurementKeys] as custom measurements,
+	// in addition to the attributes created by [Measurement].
+	MeasureListedKeys
+	// MeasureAllNumbers submits all numeric attributes as custom measurements.
+	MeasureAllNumbers
+)
+
+// measurement is the type of the value created by [Measurement].
+type measurement float64
+
+// Measurement returns an attribute which is always submitted as
+// a custom measurement regardless of [HandlerOptions.MeasurementPolicy].
+func Measurement(key string, v float64) slog.Attr {
+	return slog.Any(key, measurement(v))
+}
+
+// numberOf converts the value of the attribute to a number.
+// The value of [slog.KindDuration] is converted to milliseconds.
+// It also reports whether the attribute has a finite numeric value,
+// since NaN and infinities cannot be encoded as measurements in JSON.
+func numberOf(v slog.Value) (float64, bool) {
+	var number float64
+	switch v.Kind() {
+	case slog.KindInt64:
+		number = float64(v.Int64())
+	case slog.KindUint64:
+		number = float64(v.Uint64())
+	case slog.KindFloat64:
+		number = v.Float64()
+	case slog.KindDuration:
+		number = float64(v.Duration()) / float64(time.Millisecond)
+	case slog.KindAny:
+		m, ok := v.Any().(measurement)
+		if !ok {
+			return 0, false
+		}
+		number = float64(m)
+	default:
+		return 0, false
+	}
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, false
+	}
+	return number, true
+}
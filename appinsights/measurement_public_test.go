@@ -0,0 +1,185 @@
+package appinsights_test
+
+import (
+	"errors"
+	"log/slog"
+	"maps"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/openclosed-dev/slogan/appinsights"
+)
+
+func TestMeasurementPolicy(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	args := []any{
+		"count", 3,
+		"size", uint64(1024),
+		"ratio", 0.5,
+		"elapsed", 1500 * time.Millisecond,
+		"name", "hello",
+		appinsights.Measurement("score", 98.5),
+		slog.Group("group1", "count", 7),
+	}
+
+	cases := []struct {
+		name         string
+		policy       appinsights.MeasurementPolicy
+		keys         []string
+		properties   map[string]string
+		measurements map[string]float64
+	}{
+		{
+			"marked",
+			appinsights.MeasureMarked,
+			nil,
+			map[string]string{
+				"count":        "3",
+				"size":         "1024",
+				"ratio":        "0.5",
+				"elapsed":      "1.5s",
+				"name":         "hello",
+				"group1.count": "7",
+			},
+			map[string]float64{
+				"score": 98.5,
+			},
+		},
+		{
+			"listed keys",
+			appinsights.MeasureListedKeys,
+			[]string{"count", "elapsed", "name", "group1.count"},
+			map[string]string{
+				"size":  "1024",
+				"ratio": "0.5",
+				"name":  "hello",
+			},
+			map[string]float64{
+				"count":        3,
+				"elapsed":      1500,
+				"score":        98.5,
+				"group1.count": 7,
+			},
+		},
+		{
+			"all numbers",
+			appinsights.MeasureAllNumbers,
+			nil,
+			map[string]string{
+				"name": "hello",
+			},
+			map[string]float64{
+				"count":        3,
+				"size":         1024,
+				"ratio":        0.5,
+				"elapsed":      1500,
+				"score":        98.5,
+				"group1.count": 7,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+
+			opts := appinsights.NewHandlerOptions(nil)
+			opts.Client = server.Client()
+			opts.MeasurementPolicy = c.policy
+			opts.MeasurementKeys = c.keys
+
+			handler, err := appinsights.NewHandler(server.connectionString(), opts)
+			if err != nil {
+				t.Fatalf("failed to create handler: %v", err)
+			}
+
+			logger := slog.New(handler)
+			logger.Info("message", args...)
+
+			handler.Close()
+
+			item := server.getTelemetry()
+
+			if actual := item.properties(); !maps.Equal(actual, c.properties) {
+				t.Errorf("expected properties are %v, but got %v", c.properties, actual)
+			}
+			if actual := item.measurements(); !maps.Equal(actual, c.measurements) {
+				t.Errorf("expected measurements are %v, but got %v", c.measurements, actual)
+			}
+		})
+	}
+}
+
+func TestMeasurementWithAttrs(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.MeasurementPolicy = appinsights.MeasureAllNumbers
+	opts.ExceptionLevel = slog.LevelError
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler).With("retries", 2)
+	logger.Error("message", "error", errors.New("failure"), "elapsed", time.Second)
+
+	handler.Close()
+
+	item := server.getTelemetry()
+
+	if item.Data.BaseType != "ExceptionData" {
+		t.Errorf("unexpected base type: %s", item.Data.BaseType)
+	}
+
+	expected := map[string]float64{
+		"retries": 2,
+		"elapsed": 1000,
+	}
+	if actual := item.measurements(); !maps.Equal(actual, expected) {
+		t.Errorf("expected measurements are %v, but got %v", expected, actual)
+	}
+}
+
+func TestNonFiniteMeasurements(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.MeasurementPolicy = appinsights.MeasureAllNumbers
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler)
+	logger.Info("message1", "count", 1)
+	logger.Info("message2", slog.Float64("ratio", math.NaN()), appinsights.Measurement("limit", math.Inf(1)))
+	logger.Info("message3", "count", 3)
+
+	handler.Close()
+
+	items := server.telemetryItems()
+	if len(items) != 3 {
+		t.Fatalf("expected 3 items, but got %d", len(items))
+	}
+
+	item := items[1]
+	if len(item.measurements()) != 0 {
+		t.Errorf("unexpected measurements: %v", item.measurements())
+	}
+	expected := map[string]string{"ratio": "NaN", "limit": "+Inf"}
+	if actual := item.properties(); !maps.Equal(actual, expected) {
+		t.Errorf("expected properties are %v, but got %v", expected, actual)
+	}
+}
@@ -0,0 +1,110 @@
+package appinsights
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// Operation identifies the logical operation,
+// such as an incoming request, which a log record belongs to.
+// The fields are mapped to the operation tags of Application Insights.
+type Operation struct {
+	// ID is the identifier of the operation, which is the trace ID in W3C Trace Context.
+	ID string
+	// ParentID is the identifier of the immediate parent of the record,
+	// which is the span ID in W3C Trace Context.
+	ParentID string
+	// Name is the name of the operation, such as "GET /users/{id}".
+	Name string
+}
+
+type operationKey struct{}
+
+// WithOperation returns a copy of ctx which carries the given operation.
+// The handler stamps the operation on every record logged with the returned context.
+func WithOperation(ctx context.Context, op Operation) context.Context {
+	return context.WithValue(ctx, operationKey{}, op)
+}
+
+// OperationFromContext returns the operation carried by ctx
+// and reports whether it was found.
+func OperationFromContext(ctx context.Context) (Operation, bool) {
+	if ctx == nil {
+		return Operation{}, false
+	}
+	op, ok := ctx.Value(operationKey{}).(Operation)
+	return op, ok
+}
+
+// ParseTraceParent parses the value of the traceparent header
+// defined in W3C Trace Context and returns the corresponding operation.
+func ParseTraceParent(traceParent string) (Operation, error) {
+
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 {
+		return Operation{}, errors.New("traceparent has too few fields")
+	}
+
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+
+	if !isHex(version, 2) || version == "ff" {
+		return Operation{}, errors.New("traceparent has invalid version")
+	}
+	if version == "00" && len(parts) != 4 {
+		return Operation{}, errors.New("traceparent has too many fields")
+	}
+	if !isHex(traceID, 32) || isZero(traceID) {
+		return Operation{}, errors.New("traceparent has invalid trace ID")
+	}
+	if !isHex(parentID, 16) || isZero(parentID) {
+		return Operation{}, errors.New("traceparent has invalid parent ID")
+	}
+	if !isHex(flags, 2) {
+		return Operation{}, errors.New("traceparent has invalid flags")
+	}
+
+	return Operation{
+		ID:       traceID,
+		ParentID: parentID,
+	}, nil
+}
+
+// isHex reports whether s consists of n lowercase hexadecimal digits.
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
+
+func addOperationToTags(tags map[string]string, op Operation) {
+	if op.ID != "" {
+		tags[operationIdTag] = op.ID
+	}
+	if op.ParentID != "" {
+		tags[operationParentIdTag] = op.ParentID
+	}
+	if op.Name != "" {
+		tags[operationNameTag] = op.Name
+	}
+}
+
+// newOperationID generates a random operation ID
+// in the format of the trace ID of W3C Trace Context.
+func newOperationID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
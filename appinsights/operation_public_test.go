@@ -0,0 +1,128 @@
+package appinsights_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/openclosed-dev/slogan/appinsights"
+)
+
+func TestLogWithOperation(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	ctx := appinsights.WithOperation(context.Background(), appinsights.Operation{
+		ID:       "4bf92f3577b34da6a3ce929d0e0e4736",
+		ParentID: "00f067aa0ba902b7",
+		Name:     "GET /users",
+	})
+
+	logger := slog.New(handler)
+	logger.InfoContext(ctx, "message")
+
+	handler.Close()
+
+	item := server.getTelemetry()
+
+	expected := map[string]string{
+		"ai.operation.id":       "4bf92f3577b34da6a3ce929d0e0e4736",
+		"ai.operation.parentId": "00f067aa0ba902b7",
+		"ai.operation.name":     "GET /users",
+	}
+	for key, value := range expected {
+		if item.Tags[key] != value {
+			t.Errorf("expected tag %s is %s, but got %s", key, value, item.Tags[key])
+		}
+	}
+}
+
+func TestLogWithOperationExtractor(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	type traceParentKey struct{}
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.OperationExtractor = func(ctx context.Context) (appinsights.Operation, bool) {
+		traceParent, ok := ctx.Value(traceParentKey{}).(string)
+		if !ok {
+			return appinsights.Operation{}, false
+		}
+		op, err := appinsights.ParseTraceParent(traceParent)
+		return op, err == nil
+	}
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	ctx := context.WithValue(context.Background(), traceParentKey{},
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	logger := slog.New(handler)
+	logger.InfoContext(ctx, "message")
+
+	handler.Close()
+
+	item := server.getTelemetry()
+
+	if item.Tags["ai.operation.id"] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("unexpected operation ID: %s", item.Tags["ai.operation.id"])
+	}
+	if item.Tags["ai.operation.parentId"] != "00f067aa0ba902b7" {
+		t.Errorf("unexpected operation parent ID: %s", item.Tags["ai.operation.parentId"])
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+
+	op, err := appinsights.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatalf("failed to parse valid traceparent: %v", err)
+	}
+	if op.ID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("unexpected operation ID: %s", op.ID)
+	}
+	if op.ParentID != "00f067aa0ba902b7" {
+		t.Errorf("unexpected operation parent ID: %s", op.ParentID)
+	}
+}
+
+func TestParseInvalidTraceParent(t *testing.T) {
+	cases := []struct {
+		name        string
+		traceParent string
+		message     string
+	}{
+		{"empty", "", "traceparent has too few fields"},
+		{"invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "traceparent has invalid version"},
+		{"too many fields", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-00", "traceparent has too many fields"},
+		{"zero trace ID", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "traceparent has invalid trace ID"},
+		{"uppercase trace ID", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", "traceparent has invalid trace ID"},
+		{"zero parent ID", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", "traceparent has invalid parent ID"},
+		{"invalid flags", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1", "traceparent has invalid flags"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := appinsights.ParseTraceParent(c.traceParent)
+			if err == nil {
+				t.Error("must be error")
+			} else if err.Error() != c.message {
+				t.Errorf("wrong error message: %s", err.Error())
+			}
+		})
+	}
+}
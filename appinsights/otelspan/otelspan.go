@@ -0,0 +1,40 @@
+// Package otelspan integrates the slog Handler in the appinsights package
+// with OpenTelemetry, so that log records are correlated with the active span.
+//
+// The package is separated from the appinsights package
+// in order to keep the latter free of the OpenTelemetry dependency.
+// Set [OperationFromContext] to the handler options to enable the integration.
+//
+//	opts := appinsights.NewHandlerOptions(slog.LevelInfo)
+//	opts.OperationExtractor = otelspan.OperationFromContext
+//	handler, err := appinsights.NewHandler(connectionString, opts)
+package otelspan
+
+import (
+	"context"
+
+	"github.com/openclosed-dev/slogan/appinsights"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OperationFromContext returns the operation
+// built from the span context carried by ctx.
+// The trace ID and the span ID are mapped to
+// the operation ID and the parent ID respectively.
+// If ctx has no valid span context, this falls back on
+// [appinsights.OperationFromContext].
+// The operation name given by [appinsights.WithOperation] is retained in either case.
+func OperationFromContext(ctx context.Context) (appinsights.Operation, bool) {
+
+	op, found := appinsights.OperationFromContext(ctx)
+
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return op, found
+	}
+
+	op.ID = spanContext.TraceID().String()
+	op.ParentID = spanContext.SpanID().String()
+
+	return op, true
+}
@@ -0,0 +1,81 @@
+package otelspan_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/openclosed-dev/slogan/appinsights"
+	"github.com/openclosed-dev/slogan/appinsights/otelspan"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newSpanContext(t *testing.T) trace.SpanContext {
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	if err != nil {
+		t.Fatalf("failed to create trace ID: %v", err)
+	}
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	if err != nil {
+		t.Fatalf("failed to create span ID: %v", err)
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	})
+}
+
+func TestOperationFromSpanContext(t *testing.T) {
+
+	ctx := trace.ContextWithSpanContext(context.Background(), newSpanContext(t))
+
+	op, found := otelspan.OperationFromContext(ctx)
+	if !found {
+		t.Fatal("operation was not found")
+	}
+	if op.ID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("unexpected operation ID: %s", op.ID)
+	}
+	if op.ParentID != "00f067aa0ba902b7" {
+		t.Errorf("unexpected operation parent ID: %s", op.ParentID)
+	}
+}
+
+func TestOperationFromSpanContextKeepsName(t *testing.T) {
+
+	ctx := appinsights.WithOperation(context.Background(), appinsights.Operation{
+		ID:   "overridden",
+		Name: "GET /users",
+	})
+	ctx = trace.ContextWithSpanContext(ctx, newSpanContext(t))
+
+	op, found := otelspan.OperationFromContext(ctx)
+	if !found {
+		t.Fatal("operation was not found")
+	}
+	if op.ID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("unexpected operation ID: %s", op.ID)
+	}
+	if op.Name != "GET /users" {
+		t.Errorf("unexpected operation name: %s", op.Name)
+	}
+}
+
+func TestOperationWithoutSpanContext(t *testing.T) {
+
+	_, found := otelspan.OperationFromContext(context.Background())
+	if found {
+		t.Error("operation must not be found")
+	}
+
+	expected := appinsights.Operation{ID: "4bf92f3577b34da6a3ce929d0e0e4736"}
+	ctx := appinsights.WithOperation(context.Background(), expected)
+
+	op, found := otelspan.OperationFromContext(ctx)
+	if !found {
+		t.Fatal("operation was not found")
+	}
+	if op != expected {
+		t.Errorf("expected operation is %v, but got %v", expected, op)
+	}
+}
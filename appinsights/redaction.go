@@ -0,0 +1,195 @@
+package appinsights
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// defaultRedactionMarker replaces the values masked by default.
+const defaultRedactionMarker = "[REDACTED]"
+
+// Mask returns the masked form of a sensitive value.
+type Mask func(value string) string
+
+// ReplaceMask returns a [Mask] which replaces the whole value with the marker.
+func ReplaceMask(marker string) Mask {
+	return func(string) string {
+		return marker
+	}
+}
+
+// KeepLastMask returns a [Mask] which keeps only the last n characters
+// of the value, such as "****1234".
+// The whole value is replaced if it has no more than n characters.
+func KeepLastMask(n int) Mask {
+	return func(value string) string {
+		runes := []rune(value)
+		if n <= 0 || len(runes) <= n {
+			return "****"
+		}
+		return "****" + string(runes[len(runes)-n:])
+	}
+}
+
+// HashMask returns a [Mask] which replaces the value with
+// its HMAC-SHA256 keyed by the given key, such as "hash:0123abcd...".
+// The same value is always masked into the same hash,
+// so that the records can still be joined by the masked values.
+func HashMask(key []byte) Mask {
+	key = append([]byte(nil), key...)
+	return func(value string) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(value))
+		return "hash:" + hex.EncodeToString(mac.Sum(nil)[:16])
+	}
+}
+
+// RedactionRule determines the sensitive data masked before submission.
+type RedactionRule struct {
+	// Keys are the patterns of the attribute keys whose whole values are masked,
+	// in the syntax of [path.Match], such as "password" or "*.secret".
+	// The patterns are matched case-insensitively against the keys
+	// qualified by the group names separated by KeySeparator,
+	// and also against the keys not qualified.
+	// The values of all attributes in a group whose key matches are also masked.
+	Keys []string
+	// Pattern matches the sensitive parts of the values,
+	// which are masked in the message, the properties, the exception messages
+	// and the context tags given by the attributes.
+	Pattern *regexp.Regexp
+	// Mask masks the sensitive data.
+	// Default value is [ReplaceMask] with "[REDACTED]".
+	Mask Mask
+}
+
+// Patterns of the sensitive values masked by [DefaultRedactionRules].
+var (
+	emailPattern            = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	creditCardPattern       = regexp.MustCompile(`\b[2-6]\d{3}(?:[ -]?\d{4}){2}[ -]?\d{3,4}\b`)
+	bearerTokenPattern      = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]+=*`)
+	connectionStringPattern = regexp.MustCompile(`(?i)\b(?:AccountKey|SharedAccessKey|SharedAccessSignature|Password|Pwd|InstrumentationKey)=[^;\s]+`)
+)
+
+// DefaultRedactionRules returns the rules masking the common sensitive data,
+// which are the values of the attributes such as "password", "token" and "*.secret",
+// and the e-mail addresses, credit card numbers, bearer tokens
+// and secrets in connection strings found anywhere.
+func DefaultRedactionRules() []RedactionRule {
+	return []RedactionRule{
+		{
+			Keys: []string{
+				"password", "*.password", "passwd", "pwd",
+				"secret", "*.secret", "*_secret",
+				"token", "*.token", "*_token",
+				"api_key", "apikey", "authorization", "cookie",
+			},
+		},
+		{Pattern: emailPattern},
+		{Pattern: creditCardPattern},
+		{Pattern: bearerTokenPattern},
+		{Pattern: connectionStringPattern},
+	}
+}
+
+// redactor masks the sensitive data by the redaction rules.
+// A nil redactor masks nothing.
+type redactor struct {
+	keys     []keyRule
+	patterns []patternRule
+}
+
+type keyRule struct {
+	pattern string
+	mask    Mask
+}
+
+type patternRule struct {
+	pattern *regexp.Regexp
+	mask    Mask
+}
+
+// newRedactor creates a redactor for the rules,
+// which is nil if there are no rules.
+func newRedactor(rules []RedactionRule) (*redactor, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	r := &redactor{}
+	for _, rule := range rules {
+		mask := rule.Mask
+		if mask == nil {
+			mask = ReplaceMask(defaultRedactionMarker)
+		}
+		for _, key := range rule.Keys {
+			pattern := strings.ToLower(key)
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid key pattern of redaction rule: %s", key)
+			}
+			r.keys = append(r.keys, keyRule{pattern: pattern, mask: mask})
+		}
+		if rule.Pattern != nil {
+			r.patterns = append(r.patterns, patternRule{pattern: rule.Pattern, mask: mask})
+		}
+	}
+	return r, nil
+}
+
+// maskOf returns the mask for the attribute whose key qualified by the groups
+// is qualifiedKey, and reports whether the attribute is sensitive.
+func (r *redactor) maskOf(qualifiedKey, key string) (Mask, bool) {
+	if r == nil || len(r.keys) == 0 {
+		return nil, false
+	}
+	qualifiedKey = strings.ToLower(qualifiedKey)
+	key = strings.ToLower(key)
+	for _, rule := range r.keys {
+		if matched, _ := path.Match(rule.pattern, qualifiedKey); matched {
+			return rule.mask, true
+		}
+		if matched, _ := path.Match(rule.pattern, key); matched {
+			return rule.mask, true
+		}
+	}
+	return nil, false
+}
+
+// maskOfGroups returns the mask for the attributes in the groups
+// and reports whether any of the groups is sensitive.
+func (r *redactor) maskOfGroups(groups []string, separator string) (Mask, bool) {
+	if r == nil || len(r.keys) == 0 {
+		return nil, false
+	}
+	for i, group := range groups {
+		if mask, found := r.maskOf(strings.Join(groups[:i+1], separator), group); found {
+			return mask, true
+		}
+	}
+	return nil, false
+}
+
+// redact masks the parts of s matched by the patterns.
+func (r *redactor) redact(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, rule := range r.patterns {
+		s = rule.pattern.ReplaceAllStringFunc(s, rule.mask)
+	}
+	return s
+}
+
+// redactValues masks the parts of the values matched by the patterns.
+func (r *redactor) redactValues(values map[string]string) {
+	if r == nil || len(r.patterns) == 0 {
+		return
+	}
+	for key, value := range values {
+		values[key] = r.redact(value)
+	}
+}
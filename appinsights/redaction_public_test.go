@@ -0,0 +1,172 @@
+package appinsights_test
+
+import (
+	"errors"
+	"log/slog"
+	"maps"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/openclosed-dev/slogan/appinsights"
+)
+
+func TestDefaultRedactionRules(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.ExceptionLevel = slog.LevelError
+	opts.RedactionRules = appinsights.DefaultRedactionRules()
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler).With("Password", "p@ssw0rd")
+	logger.Info("signed up by alice@example.com",
+		slog.Group("db", "secret", "s3cr3t", "host", "db.example"),
+		"card", "4111 1111 1111 1111",
+		"header", "Bearer eyJhbGciOiJIUzI1NiJ9.e30.abc",
+		"conn", "Server=db;User Id=app;Password=hunter2;",
+		"elapsed", "1700000000000",
+		"user.id", "bob@example.com",
+	)
+	logger.Error("failed", "error", errors.New("no account for carol@example.com"))
+
+	handler.Close()
+
+	item := server.getTelemetry()
+
+	if item.Data.BaseData.Message != "signed up by [REDACTED]" {
+		t.Errorf("unexpected message: %s", item.Data.BaseData.Message)
+	}
+	expected := map[string]string{
+		"Password":  "[REDACTED]",
+		"db.secret": "[REDACTED]",
+		"db.host":   "db.example",
+		"card":      "[REDACTED]",
+		"header":    "[REDACTED]",
+		"conn":      "Server=db;User Id=app;[REDACTED];",
+		"elapsed":   "1700000000000",
+	}
+	for key, value := range expected {
+		if actual := item.properties()[key]; actual != value {
+			t.Errorf("expected property %s is %s, but got %s", key, value, actual)
+		}
+	}
+	if item.Tags["ai.user.id"] != "[REDACTED]" {
+		t.Errorf("unexpected tags: %v", item.Tags)
+	}
+
+	item = server.getTelemetry()
+
+	if len(item.Data.BaseData.Exceptions) == 0 {
+		t.Fatal("exception must be submitted")
+	}
+	if message := item.Data.BaseData.Exceptions[0].Message; message != "no account for [REDACTED]" {
+		t.Errorf("unexpected exception message: %s", message)
+	}
+}
+
+func TestRedactionMasks(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.RedactionRules = []appinsights.RedactionRule{
+		{Keys: []string{"*.phone"}, Mask: appinsights.KeepLastMask(4)},
+		{Keys: []string{"customer"}, Mask: appinsights.HashMask([]byte("key"))},
+		{Pattern: regexp.MustCompile(`order-\d+`), Mask: appinsights.ReplaceMask("order-*")},
+	}
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler)
+	logger.Info("placed order-123",
+		slog.Group("contact", "phone", "+81-90-1234-5678"),
+		"customer", "alice",
+		// fits in the limit only if redacted before truncation
+		"note", strings.Repeat("x", 8180)+"order-12345678901",
+	)
+	logger.Info("message", "customer", "alice")
+
+	handler.Close()
+
+	first := server.getTelemetry()
+	second := server.getTelemetry()
+
+	if first.Data.BaseData.Message != "placed order-*" {
+		t.Errorf("unexpected message: %s", first.Data.BaseData.Message)
+	}
+	if phone := first.properties()["contact.phone"]; phone != "****5678" {
+		t.Errorf("unexpected phone: %s", phone)
+	}
+	customer := first.properties()["customer"]
+	if !strings.HasPrefix(customer, "hash:") || strings.Contains(customer, "alice") {
+		t.Errorf("unexpected customer: %s", customer)
+	}
+	if second.properties()["customer"] != customer {
+		t.Errorf("hash must be consistent: %s", second.properties()["customer"])
+	}
+	if note := first.properties()["note"]; !strings.HasSuffix(note, "order-*") {
+		t.Errorf("unexpected note: ...%s", note[len(note)-10:])
+	}
+}
+
+func TestInvalidRedactionRule(t *testing.T) {
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.RedactionRules = []appinsights.RedactionRule{{Keys: []string{"[a-"}}}
+
+	_, err := appinsights.NewHandler("InstrumentationKey="+instrumentationKey, opts)
+	if err == nil {
+		t.Error("error must be returned")
+	}
+}
+
+func TestRedactionOfGroups(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.RedactionRules = appinsights.DefaultRedactionRules()
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler)
+	logger.Info("message",
+		slog.Group("secret", "value", "x", slog.Group("nested", "value", "y")),
+		slog.Group("db", slog.Group("secret", "value", "z"), "host", "db.example"),
+	)
+	logger.WithGroup("token").Info("message", "value", "w")
+
+	handler.Close()
+
+	expected := map[string]string{
+		"secret.value":        "[REDACTED]",
+		"secret.nested.value": "[REDACTED]",
+		"db.secret.value":     "[REDACTED]",
+		"db.host":             "db.example",
+	}
+	if actual := server.getTelemetry().properties(); !maps.Equal(actual, expected) {
+		t.Errorf("expected properties are %v, but got %v", expected, actual)
+	}
+
+	if actual := server.getTelemetry().properties(); actual["token.value"] != "[REDACTED]" {
+		t.Errorf("unexpected properties: %v", actual)
+	}
+}
@@ -0,0 +1,161 @@
+package appinsights
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+// RouterOptions are options for a [Router].
+type RouterOptions struct {
+	// Targets are the connection strings of the Application Insights resources
+	// keyed by the names of the targets returned by Route.
+	Targets map[string]string
+	// Route returns the name of the target to which the record is submitted.
+	// The attrs are the attributes given by WithAttrs followed by those of the record,
+	// whose keys are not qualified by the groups.
+	// The record is submitted to the default target if the name is empty or unknown.
+	// Every record is submitted to the default target if this is nil.
+	Route func(ctx context.Context, level slog.Level, attrs []slog.Attr) string
+	// HandlerOptions are the options of the handlers for all targets,
+	// which may be nil if the default settings are sufficient.
+	HandlerOptions *HandlerOptions
+}
+
+// Router is a [slog.Handler] that submits each log record to one of
+// several Application Insights resources, such as the resources of tenants.
+// Each target has its own [Handler] which batches and transmits the records.
+type Router struct {
+	route    func(ctx context.Context, level slog.Level, attrs []slog.Attr) string
+	fallback *Handler
+	handlers map[string]*Handler
+	// attrs are the attributes given by WithAttrs, which are passed to route.
+	attrs []slog.Attr
+}
+
+// NewRouter creates a [Router] that submits log records to the targets
+// given by opts, or to the default target of defaultConnectionString.
+func NewRouter(defaultConnectionString string, opts *RouterOptions) (*Router, error) {
+	if opts == nil {
+		opts = &RouterOptions{}
+	}
+
+	fallback, err := NewHandler(defaultConnectionString, opts.HandlerOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Router{
+		route:    opts.Route,
+		fallback: fallback,
+		handlers: make(map[string]*Handler, len(opts.Targets)),
+	}
+
+	for name, connectionString := range opts.Targets {
+		h, err := NewHandler(connectionString, opts.HandlerOptions)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("invalid target %s: %w", name, err)
+		}
+		r.handlers[name] = h
+	}
+
+	return r, nil
+}
+
+// Enabled reports whether the router handles records at the given level.
+func (r *Router) Enabled(ctx context.Context, level slog.Level) bool {
+	return r.fallback.Enabled(ctx, level)
+}
+
+// Handle submits the log Record to the target chosen by [RouterOptions.Route].
+func (r *Router) Handle(ctx context.Context, record slog.Record) error {
+	return r.target(ctx, record).Handle(ctx, record)
+}
+
+// WithAttrs returns a new [Router] whose handlers have the attributes
+// of r's handlers followed by attrs.
+func (r *Router) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return r
+	}
+	return r.derive(func(h *Handler) *Handler {
+		return h.withAttrs(attrs)
+	}, slices.Concat(r.attrs, attrs))
+}
+
+// WithGroup returns a new [Router] whose handlers have the given group
+// appended to the groups of r's handlers.
+func (r *Router) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return r
+	}
+	return r.derive(func(h *Handler) *Handler {
+		return h.withGroup(name)
+	}, r.attrs)
+}
+
+// Flush submits the buffered log records of all targets immediately
+// and waits until the transmission is complete or ctx is done.
+func (r *Router) Flush(ctx context.Context) error {
+	return r.each(func(h *Handler) error {
+		return h.Flush(ctx)
+	})
+}
+
+// Shutdown shuts down the handlers of all targets as [Handler.Shutdown] does,
+// and returns the errors joined.
+func (r *Router) Shutdown(ctx context.Context) error {
+	return r.each(func(h *Handler) error {
+		return h.Shutdown(ctx)
+	})
+}
+
+// Close is equivalent to [Router.Shutdown] with the timeout of 30 seconds.
+func (r *Router) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCloseTimeout)
+	defer cancel()
+	return r.Shutdown(ctx)
+}
+
+// target returns the handler of the target for the record.
+func (r *Router) target(ctx context.Context, record slog.Record) *Handler {
+	if r.route == nil {
+		return r.fallback
+	}
+
+	attrs := make([]slog.Attr, 0, len(r.attrs)+record.NumAttrs())
+	attrs = append(attrs, r.attrs...)
+	record.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+
+	if h, found := r.handlers[r.route(ctx, record.Level, attrs)]; found {
+		return h
+	}
+	return r.fallback
+}
+
+func (r *Router) derive(derive func(*Handler) *Handler, attrs []slog.Attr) *Router {
+	handlers := make(map[string]*Handler, len(r.handlers))
+	for name, h := range r.handlers {
+		handlers[name] = derive(h)
+	}
+	return &Router{
+		route:    r.route,
+		fallback: derive(r.fallback),
+		handlers: handlers,
+		attrs:    attrs,
+	}
+}
+
+func (r *Router) each(f func(*Handler) error) error {
+	errs := []error{f(r.fallback)}
+	for _, h := range r.handlers {
+		errs = append(errs, f(h))
+	}
+	return errors.Join(errs...)
+}
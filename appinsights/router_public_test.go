@@ -0,0 +1,82 @@
+package appinsights_test
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"testing"
+
+	"github.com/openclosed-dev/slogan/appinsights"
+)
+
+func routeByTenant(_ context.Context, _ slog.Level, attrs []slog.Attr) string {
+	for _, a := range attrs {
+		if a.Key == "tenant" {
+			return a.Value.String()
+		}
+	}
+	return ""
+}
+
+func TestRouter(t *testing.T) {
+
+	fallback := newStubServer(8)
+	defer fallback.Close()
+	contoso := newStubServer(8)
+	defer contoso.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = fallback.Client()
+
+	router, err := appinsights.NewRouter(fallback.connectionString(), &appinsights.RouterOptions{
+		Targets:        map[string]string{"contoso": contoso.connectionString()},
+		Route:          routeByTenant,
+		HandlerOptions: opts,
+	})
+	if err != nil {
+		t.Fatalf("failed to create router: %v", err)
+	}
+
+	logger := slog.New(router)
+	logger.Info("message1", "tenant", "contoso")
+	logger.Info("message2", "tenant", "fabrikam")
+	logger.Info("message3")
+	logger.With("tenant", "contoso").WithGroup("group1").Info("message4", "key1", "value1")
+
+	if err := router.Close(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	messages := func(items []*telemetry) []string {
+		var messages []string
+		for _, item := range items {
+			messages = append(messages, item.Data.BaseData.Message)
+		}
+		return messages
+	}
+
+	contosoItems := contoso.telemetryItems()
+	if m := messages(contosoItems); len(m) != 2 || m[0] != "message1" || m[1] != "message4" {
+		t.Errorf("unexpected messages of contoso: %v", m)
+	}
+	if m := messages(fallback.telemetryItems()); len(m) != 2 || m[0] != "message2" || m[1] != "message3" {
+		t.Errorf("unexpected messages of default: %v", m)
+	}
+
+	if len(contosoItems) == 2 {
+		expected := map[string]string{"tenant": "contoso", "group1.key1": "value1"}
+		if !maps.Equal(contosoItems[1].properties(), expected) {
+			t.Errorf("unexpected properties: %v", contosoItems[1].properties())
+		}
+	}
+}
+
+func TestRouterWithInvalidTarget(t *testing.T) {
+
+	_, err := appinsights.NewRouter("InstrumentationKey="+instrumentationKey, &appinsights.RouterOptions{
+		Targets: map[string]string{"contoso": "IngestionEndpoint=https://example.com/"},
+	})
+	if err == nil {
+		t.Error("error must be returned")
+	}
+}
@@ -0,0 +1,128 @@
+package appinsights
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// messageServer records the messages of the telemetry items it received
+// while it is available.
+type messageServer struct {
+	*httptest.Server
+	available atomic.Bool
+	mu        sync.Mutex
+	messages  []string
+}
+
+func newMessageServer() *messageServer {
+	s := &messageServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		payload, _ := io.ReadAll(req.Body)
+		b, err := decompress(payload)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !s.available.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		s.mu.Lock()
+		for _, line := range b {
+			var item struct {
+				Data struct {
+					BaseData messageData `json:"baseData"`
+				} `json:"data"`
+			}
+			if json.Unmarshal(line, &item) == nil {
+				s.messages = append(s.messages, item.Data.BaseData.Message)
+			}
+		}
+		s.mu.Unlock()
+	}))
+	return s
+}
+
+func (s *messageServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.messages...)
+}
+
+func (s *messageServer) connectionString() string {
+	return "InstrumentationKey=f81d4fae-7dec-11d0-a765-00a0c91e6bf6;IngestionEndpoint=" + s.URL
+}
+
+func TestRouterTransmitsStoredBatchesToOwnTargets(t *testing.T) {
+
+	saved := storageRetryMinInterval
+	storageRetryMinInterval = 10 * time.Millisecond
+	defer func() { storageRetryMinInterval = saved }()
+
+	dir := t.TempDir()
+	route := func(_ context.Context, _ slog.Level, attrs []slog.Attr) string {
+		for _, a := range attrs {
+			if a.Key == "tenant" {
+				return a.Value.String()
+			}
+		}
+		return ""
+	}
+
+	servers := map[string]*messageServer{}
+	for _, name := range []string{"", "contoso", "fabrikam"} {
+		servers[name] = newMessageServer()
+		defer servers[name].Close()
+	}
+
+	newRouter := func() *Router {
+		opts := NewHandlerOptions(nil)
+		opts.StorageDir = dir
+		router, err := NewRouter(servers[""].connectionString(), &RouterOptions{
+			Targets: map[string]string{
+				"contoso":  servers["contoso"].connectionString(),
+				"fabrikam": servers["fabrikam"].connectionString(),
+			},
+			Route:          route,
+			HandlerOptions: opts,
+		})
+		if err != nil {
+			t.Fatalf("failed to create router: %v", err)
+		}
+		return router
+	}
+
+	// The batches are stored while the endpoints are unavailable.
+	router := newRouter()
+	logger := slog.New(router)
+	logger.Info("default")
+	logger.Info("contoso", "tenant", "contoso")
+	logger.Info("fabrikam", "tenant", "fabrikam")
+	router.Close()
+
+	for _, server := range servers {
+		server.available.Store(true)
+	}
+
+	router = newRouter()
+	defer router.Close()
+
+	expected := map[string]string{"": "default", "contoso": "contoso", "fabrikam": "fabrikam"}
+	deadline := time.Now().Add(5 * time.Second)
+	for name, message := range expected {
+		for len(servers[name].received()) == 0 && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if received := servers[name].received(); len(received) != 1 || received[0] != message {
+			t.Errorf("target %q received unexpected messages: %v", name, received)
+		}
+	}
+}
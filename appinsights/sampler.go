@@ -0,0 +1,179 @@
+package appinsights
+
+import (
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+const defaultSamplingExemptLevel = slog.LevelWarn
+
+// Sampler decides which log records are submitted
+// to reduce the volume of telemetry.
+type Sampler interface {
+	// Sample reports whether the record at the given level
+	// which belongs to the operation is submitted,
+	// and returns the percentage of the records being submitted, from 0 to 100.
+	// The percentage is used by Application Insights to extrapolate the counts of telemetry.
+	Sample(operationID string, level slog.Level) (sampled bool, percentage float64)
+}
+
+type fixedRateSampler struct {
+	percentage float64
+}
+
+// NewFixedRateSampler returns a [Sampler] which submits
+// the given percentage of the operations.
+// The decision is made by the hash of the operation ID
+// in the same way as the other Application Insights SDKs,
+// so that all records of an operation are either submitted or dropped together.
+func NewFixedRateSampler(percentage float64) Sampler {
+	return &fixedRateSampler{percentage: min(max(percentage, 0), 100)}
+}
+
+func (s *fixedRateSampler) Sample(operationID string, _ slog.Level) (bool, float64) {
+	return samplingScore(operationID) < s.percentage, s.percentage
+}
+
+// samplingScore returns the score of the operation ID from 0 to 100,
+// which is compared with the sampling percentage.
+func samplingScore(operationID string) float64 {
+	if operationID == "" {
+		return 0
+	}
+	for len(operationID) < 8 {
+		operationID += operationID
+	}
+	hash := int32(5381)
+	for _, c := range operationID {
+		hash = (hash << 5) + hash + int32(c)
+	}
+	if hash == math.MinInt32 {
+		hash = math.MaxInt32
+	} else if hash < 0 {
+		hash = -hash
+	}
+	return float64(hash) / math.MaxInt32 * 100
+}
+
+// Default values of [AdaptiveSamplerOptions].
+const (
+	defaultMaxItemsPerSecond  = 5
+	defaultMinPercentage      = 0.1
+	defaultMaxPercentage      = 100
+	defaultEvaluationInterval = 15 * time.Second
+)
+
+// movingAverageRatio is the weight of the latest throughput
+// in the moving average observed by [AdaptiveSampler].
+const movingAverageRatio = 0.25
+
+// AdaptiveSamplerOptions are options for an [AdaptiveSampler].
+type AdaptiveSamplerOptions struct {
+	// MaxItemsPerSecond is the target number of records submitted per second.
+	// Default value is 5.
+	MaxItemsPerSecond float64
+	// MinPercentage is the lower bound of the sampling percentage.
+	// Default value is 0.1.
+	MinPercentage float64
+	// MaxPercentage is the upper bound of the sampling percentage,
+	// which is also the initial percentage.
+	// Default value is 100.
+	MaxPercentage float64
+	// EvaluationInterval is the interval at which the throughput is evaluated
+	// and the sampling percentage is adjusted.
+	// Default value is 15 seconds.
+	EvaluationInterval time.Duration
+}
+
+// AdaptiveSampler is a [Sampler] which adjusts the sampling percentage
+// to keep the number of records submitted per second near the target,
+// in the same way as the adaptive sampling of the .NET SDK.
+// As [NewFixedRateSampler], the decision is made by the hash of the operation ID.
+type AdaptiveSampler struct {
+	opts AdaptiveSamplerOptions
+	now  func() time.Time
+
+	mu         sync.Mutex
+	percentage float64
+	// count is the number of records sampled since evaluated is updated.
+	count     int
+	evaluated time.Time
+	// average is the moving average of the records per second before sampling.
+	average float64
+}
+
+// NewAdaptiveSampler creates an [AdaptiveSampler].
+// opts may be nil if the default settings are sufficient.
+func NewAdaptiveSampler(opts *AdaptiveSamplerOptions) *AdaptiveSampler {
+	var filled AdaptiveSamplerOptions
+	if opts != nil {
+		filled = *opts
+	}
+	if filled.MaxItemsPerSecond <= 0 {
+		filled.MaxItemsPerSecond = defaultMaxItemsPerSecond
+	}
+	if filled.MaxPercentage <= 0 || filled.MaxPercentage > 100 {
+		filled.MaxPercentage = defaultMaxPercentage
+	}
+	if filled.MinPercentage <= 0 {
+		filled.MinPercentage = defaultMinPercentage
+	}
+	filled.MinPercentage = min(filled.MinPercentage, filled.MaxPercentage)
+	if filled.EvaluationInterval <= 0 {
+		filled.EvaluationInterval = defaultEvaluationInterval
+	}
+
+	return &AdaptiveSampler{
+		opts:       filled,
+		now:        time.Now,
+		percentage: filled.MaxPercentage,
+		evaluated:  time.Now(),
+	}
+}
+
+func (s *AdaptiveSampler) Sample(operationID string, _ slog.Level) (bool, float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now := s.now(); now.Sub(s.evaluated) >= s.opts.EvaluationInterval {
+		s.evaluate(now)
+	}
+	s.count++
+
+	return samplingScore(operationID) < s.percentage, s.percentage
+}
+
+// Percentage returns the current sampling percentage.
+func (s *AdaptiveSampler) Percentage() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.percentage
+}
+
+// evaluate updates the moving average of the throughput
+// and adjusts the sampling percentage for it.
+func (s *AdaptiveSampler) evaluate(now time.Time) {
+	observed := float64(s.count) / now.Sub(s.evaluated).Seconds()
+	if s.average == 0 {
+		s.average = observed
+	} else {
+		s.average = s.average*(1-movingAverageRatio) + observed*movingAverageRatio
+	}
+	s.count = 0
+	s.evaluated = now
+
+	percentage := s.opts.MaxPercentage
+	if s.average > 0 {
+		percentage = s.opts.MaxItemsPerSecond / s.average * 100
+		// Rounds to 100/N so that one of every N operations is submitted.
+		percentage = 100 / math.Ceil(100/min(percentage, 100))
+	}
+	percentage = min(max(percentage, s.opts.MinPercentage), s.opts.MaxPercentage)
+
+	if percentage != s.percentage {
+		diagnosticsf("Sampling percentage changed from %g to %g", s.percentage, percentage)
+		s.percentage = percentage
+	}
+}
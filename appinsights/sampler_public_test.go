@@ -0,0 +1,89 @@
+package appinsights_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/openclosed-dev/slogan/appinsights"
+)
+
+func TestFixedRateSampler(t *testing.T) {
+
+	server := newStubServer(200)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.Sampler = appinsights.NewFixedRateSampler(50)
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler)
+	for i := range 50 {
+		ctx := appinsights.WithOperation(context.Background(), appinsights.Operation{
+			ID: fmt.Sprintf("%016x%016x", uint64(i+1)*0x9e3779b97f4a7c15, uint64(i+1)*0xbf58476d1ce4e5b9),
+		})
+		logger.InfoContext(ctx, "first")
+		logger.InfoContext(ctx, "second")
+	}
+
+	handler.Close()
+
+	items := server.telemetryItems()
+	if len(items) == 0 || len(items) == 100 {
+		t.Fatalf("unexpected number of sampled records: %d", len(items))
+	}
+
+	counts := make(map[string]int)
+	for _, item := range items {
+		counts[item.Tags["ai.operation.id"]]++
+		if item.SampleRate != 50 {
+			t.Errorf("unexpected sample rate: %v", item.SampleRate)
+		}
+	}
+	for id, count := range counts {
+		if count != 2 {
+			t.Errorf("records of operation %s were not sampled together", id)
+		}
+	}
+}
+
+func TestSamplingExemptLevel(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.Sampler = appinsights.NewFixedRateSampler(0)
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler)
+	logger.Info("sampled out")
+	logger.Warn("exempt")
+	logger.Error("exempt")
+
+	handler.Close()
+
+	items := server.telemetryItems()
+	if len(items) != 2 {
+		t.Fatalf("expected 2 records, but got %d", len(items))
+	}
+	for _, item := range items {
+		if item.Data.BaseData.Message != "exempt" {
+			t.Errorf("unexpected message: %s", item.Data.BaseData.Message)
+		}
+		if item.SampleRate != 0 {
+			t.Errorf("unexpected sample rate: %v", item.SampleRate)
+		}
+	}
+}
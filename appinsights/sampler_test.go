@@ -0,0 +1,60 @@
+package appinsights
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveSamplerAdjustsPercentage(t *testing.T) {
+
+	now := time.Now()
+
+	s := NewAdaptiveSampler(&AdaptiveSamplerOptions{
+		MaxItemsPerSecond:  10,
+		MinPercentage:      1,
+		EvaluationInterval: time.Second,
+	})
+	s.now = func() time.Time { return now }
+	s.evaluated = now
+
+	if p := s.Percentage(); p != 100 {
+		t.Fatalf("unexpected initial percentage: %v", p)
+	}
+
+	// 100 records per second
+	for range 10 {
+		for range 100 {
+			s.Sample(newOperationID(), slog.LevelInfo)
+		}
+		now = now.Add(time.Second)
+	}
+	s.Sample(newOperationID(), slog.LevelInfo)
+
+	if p := s.Percentage(); p != 10 {
+		t.Errorf("expected 10 percent, but got %v", p)
+	}
+
+	// 10000 records per second
+	for range 20 {
+		for range 10000 {
+			s.Sample(newOperationID(), slog.LevelInfo)
+		}
+		now = now.Add(time.Second)
+	}
+	s.Sample(newOperationID(), slog.LevelInfo)
+
+	if p := s.Percentage(); p != 1 {
+		t.Errorf("expected minimum percentage, but got %v", p)
+	}
+
+	// 1 record per second for a while
+	for range 60 {
+		now = now.Add(time.Second)
+		s.Sample(newOperationID(), slog.LevelInfo)
+	}
+
+	if p := s.Percentage(); p != 100 {
+		t.Errorf("expected maximum percentage, but got %v", p)
+	}
+}
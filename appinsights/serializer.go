@@ -0,0 +1,80 @@
+package appinsights
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// batch is a list of telemetry items encoded as JSON objects.
+type batch [][]byte
+
+// serialize encodes each of the telemetry items into a JSON object.
+// The items which cannot be encoded are left out of the batch
+// and reported by the returned error.
+func serialize(items []*envelope) (batch, error) {
+
+	b := make(batch, 0, len(items))
+	var errs []error
+	for _, item := range items {
+		line, err := json.Marshal(item)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to encode telemetry item: %w", err))
+			continue
+		}
+		diagnosticsf("Telemetry item: %s", line)
+		b = append(b, line)
+	}
+
+	return b, errors.Join(errs...)
+}
+
+// compress returns a gzip-compressed stream of newline-delimited JSON objects,
+// which is accepted by the ingestion endpoint.
+func (b batch) compress() ([]byte, error) {
+
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+
+	for _, line := range b {
+		gzipWriter.Write(line)
+		gzipWriter.Write([]byte{'\n'})
+	}
+
+	if err := gzipWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress telemetry items: %w", err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// decompress restores the batch from the payload created by [batch.compress].
+func decompress(payload []byte) (batch, error) {
+
+	gzipReader, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress telemetry items: %w", err)
+	}
+	defer gzipReader.Close()
+
+	var b batch
+	reader := bufio.NewReader(gzipReader)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			b = append(b, line)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress telemetry items: %w", err)
+		}
+	}
+
+	return b, nil
+}
@@ -12,17 +12,38 @@ import (
 // fake instrumentation key
 const instrumentationKey = "f81d4fae-7dec-11d0-a765-00a0c91e6bf6"
 
+// Severity level of trace telemetry
+type severityLevel int
+
+const (
+	severityVerbose severityLevel = iota
+	severityInformation
+	severityWarning
+	severityError
+	severityCritical
+)
+
 // Trace telemetry item collected by Application Insights
 type telemetry struct {
-	Time string `json:"time"`
-	IKey string `json:"iKey"`
-	Data struct {
+	Time       string            `json:"time"`
+	IKey       string            `json:"iKey"`
+	SampleRate float64           `json:"sampleRate"`
+	Tags       map[string]string `json:"tags"`
+	Data       struct {
 		BaseType string `json:"baseType"`
 		BaseData struct {
-			Ver           int               `json:"ver"`
-			Message       string            `json:"message"`
-			SeverityLevel int               `json:"severityLevel"`
-			Properties    map[string]string `json:"properties"`
+			Ver           int                `json:"ver"`
+			Message       string             `json:"message"`
+			Name          string             `json:"name"`
+			SeverityLevel int                `json:"severityLevel"`
+			Properties    map[string]string  `json:"properties"`
+			Measurements  map[string]float64 `json:"measurements"`
+			Exceptions    []struct {
+				Id       int    `json:"id"`
+				OuterId  int    `json:"outerId"`
+				TypeName string `json:"typeName"`
+				Message  string `json:"message"`
+			} `json:"exceptions"`
 		} `json:"baseData"`
 	} `json:"data"`
 }
@@ -31,6 +52,10 @@ func (t *telemetry) properties() map[string]string {
 	return t.Data.BaseData.Properties
 }
 
+func (t *telemetry) measurements() map[string]float64 {
+	return t.Data.BaseData.Measurements
+}
+
 type stubServer struct {
 	*httptest.Server
 	items chan *telemetry
@@ -0,0 +1,261 @@
+package appinsights
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultStorageMaxSize = int64(50 * 1024 * 1024)
+	defaultStorageMaxAge  = 48 * time.Hour
+)
+
+// File extensions of the stored batches.
+const (
+	// storedExt is the extension of a batch waiting for transmission.
+	storedExt = ".trn"
+	// leasedExt is the extension of a batch being transmitted by a process.
+	leasedExt = ".lease"
+	// tempExt is the extension of a batch being written.
+	tempExt = ".tmp"
+)
+
+var errStoredBatchExpired = errors.New("stored batch expired")
+
+// storageLeaseTimeout is the time after which a leased batch
+// is considered abandoned by a crashed process and can be taken over.
+var storageLeaseTimeout = 10 * time.Minute
+
+// storage keeps the batches which could not be transmitted in a directory.
+// The directory may be shared by several processes.
+// Each batch is stored in a file named after its creation time,
+// and a process takes the exclusive ownership of a file
+// by renaming it atomically before transmitting it.
+type storage struct {
+	dir      string
+	maxSize  int64
+	maxAge   time.Duration
+	failures *failureReporter
+}
+
+// storedBatch is a batch loaded from the storage.
+type storedBatch struct {
+	path  string
+	batch batch
+}
+
+// newStorage creates a storage for the resource of iKey and endpoint.
+// The batches are stored in the subdirectory of dir named after the resource,
+// so that the directory can be shared by the clients of different resources
+// and each batch is transmitted only to the resource for which it was stored.
+func newStorage(dir, iKey, endpoint string, maxSize int64, maxAge time.Duration, failures *failureReporter) (*storage, error) {
+	dir = filepath.Join(dir, storageNamespace(iKey, endpoint))
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	return &storage{
+		dir:      dir,
+		maxSize:  maxSize,
+		maxAge:   maxAge,
+		failures: failures,
+	}, nil
+}
+
+// storageNamespace returns the name of the subdirectory
+// storing the batches of the resource of iKey and endpoint.
+func storageNamespace(iKey, endpoint string) string {
+	sum := sha256.Sum256([]byte(iKey + "\n" + endpoint))
+	return hex.EncodeToString(sum[:8])
+}
+
+// save writes the batch to a new file.
+// The batch is discarded if the storage would exceed its maximum size.
+func (s *storage) save(b batch) error {
+
+	payload, err := b.compress()
+	if err != nil {
+		return err
+	}
+
+	size, err := s.size()
+	if err != nil {
+		return err
+	}
+	if size+int64(len(payload)) > s.maxSize {
+		return fmt.Errorf("storage is full, %d items were discarded", len(b))
+	}
+
+	name, err := newStoredFileName(time.Now())
+	if err != nil {
+		return err
+	}
+
+	// Writes to a temporary file first so that other processes never see a partial file.
+	path := filepath.Join(s.dir, name)
+	temp := path + tempExt
+	if err := os.WriteFile(temp, payload, 0o600); err != nil {
+		os.Remove(temp)
+		return fmt.Errorf("failed to write stored batch: %w", err)
+	}
+	if err := os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		return fmt.Errorf("failed to write stored batch: %w", err)
+	}
+
+	diagnosticsf("Stored %d items in %s", len(b), path)
+
+	return nil
+}
+
+// lease takes the ownership of the oldest stored batch and loads it.
+// It returns nil if there is no batch to transmit.
+// The expired batches are deleted and the abandoned leases are recovered on the way.
+func (s *storage) lease() (*storedBatch, error) {
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage directory: %w", err)
+	}
+
+	now := time.Now()
+	var candidates []string
+
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(s.dir, name)
+		switch filepath.Ext(name) {
+		case storedExt:
+			if s.expired(name, now) {
+				s.discard(path)
+			} else {
+				candidates = append(candidates, name)
+			}
+		case leasedExt:
+			if info, err := entry.Info(); err == nil && now.Sub(info.ModTime()) > storageLeaseTimeout {
+				// The process which leased the batch has probably crashed.
+				if os.Rename(path, strings.TrimSuffix(path, leasedExt)) == nil {
+					candidates = append(candidates, strings.TrimSuffix(name, leasedExt))
+				}
+			}
+		case tempExt:
+			if info, err := entry.Info(); err == nil && now.Sub(info.ModTime()) > storageLeaseTimeout {
+				// left by a crashed process
+				os.Remove(path)
+			}
+		}
+	}
+
+	// The names begin with the creation time.
+	slices.Sort(candidates)
+
+	for _, name := range candidates {
+		path := filepath.Join(s.dir, name)
+		leased := path + leasedExt
+		if err := os.Rename(path, leased); err != nil {
+			// Another process has taken the batch.
+			continue
+		}
+		os.Chtimes(leased, now, now)
+
+		payload, err := os.ReadFile(leased)
+		if err != nil {
+			os.Remove(leased)
+			continue
+		}
+		b, err := decompress(payload)
+		if err != nil {
+			os.Remove(leased)
+			s.failures.report(&TransmissionError{Err: err})
+			continue
+		}
+
+		return &storedBatch{path: leased, batch: b}, nil
+	}
+
+	return nil, nil
+}
+
+// remove deletes the leased batch after it was transmitted.
+func (s *storage) remove(b *storedBatch) {
+	os.Remove(b.path)
+}
+
+// release returns the leased batch to the storage to be transmitted later.
+func (s *storage) release(b *storedBatch) {
+	os.Rename(b.path, strings.TrimSuffix(b.path, leasedExt))
+}
+
+// size returns the total size of the files in the storage.
+func (s *storage) size() (int64, error) {
+	var total int64
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				// removed by another process
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read storage directory: %w", err)
+	}
+	return total, nil
+}
+
+// expired reports whether the batch is older than the maximum age.
+func (s *storage) expired(name string, now time.Time) bool {
+	created, ok := parseStoredFileName(name)
+	return ok && now.Sub(created) > s.maxAge
+}
+
+// discard removes the expired batch.
+func (s *storage) discard(path string) {
+	var dropped int
+	if payload, err := os.ReadFile(path); err == nil {
+		if b, err := decompress(payload); err == nil {
+			dropped = len(b)
+		}
+	}
+	if err := os.Remove(path); err == nil {
+		s.failures.report(&TransmissionError{Dropped: dropped, Err: errStoredBatchExpired})
+	}
+}
+
+// newStoredFileName returns a unique file name which begins with the creation time.
+func newStoredFileName(t time.Time) (string, error) {
+	var suffix [8]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%020d-%s%s", t.UnixNano(), hex.EncodeToString(suffix[:]), storedExt), nil
+}
+
+// parseStoredFileName returns the creation time of the stored batch.
+func parseStoredFileName(name string) (time.Time, bool) {
+	prefix, _, found := strings.Cut(name, "-")
+	if !found {
+		return time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(prefix, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
@@ -0,0 +1,179 @@
+package appinsights
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestBatch(t *testing.T, count int) batch {
+	items := make([]*envelope, 0, count)
+	for range count {
+		items = append(items, newTestEnvelope())
+	}
+	b, err := serialize(items)
+	if err != nil {
+		t.Fatalf("failed to serialize: %v", err)
+	}
+	return b
+}
+
+func newTestStorage(t *testing.T) *storage {
+	s, err := newStorage(t.TempDir(), "f81d4fae-7dec-11d0-a765-00a0c91e6bf6", "https://dc.services.visualstudio.com/v2/track", defaultStorageMaxSize, defaultStorageMaxAge, newFailureReporter(nil))
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	return s
+}
+
+func TestStorageSaveAndLease(t *testing.T) {
+
+	s := newTestStorage(t)
+
+	saved := newTestBatch(t, 3)
+	if err := s.save(saved); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+
+	stored, err := s.lease()
+	if err != nil {
+		t.Fatalf("failed to lease: %v", err)
+	}
+	if stored == nil {
+		t.Fatal("stored batch was not found")
+	}
+	if !slices.EqualFunc(stored.batch, saved, slices.Equal) {
+		t.Errorf("stored batch was changed")
+	}
+
+	// The batch is owned by the first lease.
+	if another, _ := s.lease(); another != nil {
+		t.Errorf("batch was leased twice")
+	}
+
+	s.release(stored)
+	stored, _ = s.lease()
+	if stored == nil {
+		t.Fatal("released batch was not found")
+	}
+
+	s.remove(stored)
+	if stored, _ = s.lease(); stored != nil {
+		t.Errorf("removed batch was found")
+	}
+}
+
+func TestStorageSeparatesResources(t *testing.T) {
+
+	dir := t.TempDir()
+	newResourceStorage := func(iKey, endpoint string) *storage {
+		s, err := newStorage(dir, iKey, endpoint, defaultStorageMaxSize, defaultStorageMaxAge, newFailureReporter(nil))
+		if err != nil {
+			t.Fatalf("failed to create storage: %v", err)
+		}
+		return s
+	}
+
+	s := newResourceStorage("f81d4fae-7dec-11d0-a765-00a0c91e6bf6", "https://dc.services.visualstudio.com/v2/track")
+	if err := s.save(newTestBatch(t, 1)); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+
+	others := []*storage{
+		newResourceStorage("00000000-0000-0000-0000-000000000000", "https://dc.services.visualstudio.com/v2/track"),
+		newResourceStorage("f81d4fae-7dec-11d0-a765-00a0c91e6bf6", "https://westus-0.in.applicationinsights.azure.com/v2/track"),
+	}
+	for _, other := range others {
+		if stored, _ := other.lease(); stored != nil {
+			t.Errorf("batch was leased by another resource: %s", other.dir)
+		}
+	}
+
+	same := newResourceStorage("f81d4fae-7dec-11d0-a765-00a0c91e6bf6", "https://dc.services.visualstudio.com/v2/track")
+	if stored, _ := same.lease(); stored == nil {
+		t.Error("batch was not leased by the same resource")
+	}
+}
+
+func TestStorageLeasesOldestFirst(t *testing.T) {
+
+	s := newTestStorage(t)
+
+	for count := 1; count <= 3; count++ {
+		if err := s.save(newTestBatch(t, count)); err != nil {
+			t.Fatalf("failed to save: %v", err)
+		}
+	}
+
+	for count := 1; count <= 3; count++ {
+		stored, _ := s.lease()
+		if stored == nil {
+			t.Fatal("stored batch was not found")
+		}
+		if len(stored.batch) != count {
+			t.Errorf("expected %d items, but got %d", count, len(stored.batch))
+		}
+		s.remove(stored)
+	}
+}
+
+func TestStorageMaxSize(t *testing.T) {
+
+	s := newTestStorage(t)
+	s.maxSize = 1
+
+	if err := s.save(newTestBatch(t, 1)); err == nil {
+		t.Error("must be error")
+	}
+
+	if stored, _ := s.lease(); stored != nil {
+		t.Errorf("batch was stored beyond the maximum size")
+	}
+}
+
+func TestStorageMaxAge(t *testing.T) {
+
+	s := newTestStorage(t)
+	s.maxAge = time.Hour
+
+	name, err := newStoredFileName(time.Now().Add(-2 * time.Hour))
+	if err != nil {
+		t.Fatalf("failed to create file name: %v", err)
+	}
+	payload, _ := newTestBatch(t, 1).compress()
+	path := filepath.Join(s.dir, name)
+	if err := os.WriteFile(path, payload, 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if stored, _ := s.lease(); stored != nil {
+		t.Errorf("expired batch was leased")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expired batch was not removed")
+	}
+}
+
+func TestStorageRecoversAbandonedLease(t *testing.T) {
+
+	s := newTestStorage(t)
+
+	if err := s.save(newTestBatch(t, 1)); err != nil {
+		t.Fatalf("failed to save: %v", err)
+	}
+
+	stored, _ := s.lease()
+	if stored == nil {
+		t.Fatal("stored batch was not found")
+	}
+
+	// The process holding the lease has crashed.
+	past := time.Now().Add(-2 * storageLeaseTimeout)
+	os.Chtimes(stored.path, past, past)
+
+	if another, _ := s.lease(); another == nil {
+		t.Errorf("abandoned batch was not recovered")
+	}
+}
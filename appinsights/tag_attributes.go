@@ -0,0 +1,63 @@
+package appinsights
+
+import (
+	"log/slog"
+	"maps"
+)
+
+// Keys of the context tags which identify the user, the session and the device.
+const (
+	userIdTag         = "ai.user.id"
+	userAuthUserIdTag = "ai.user.authUserId"
+	sessionIdTag      = "ai.session.id"
+	deviceTypeTag     = "ai.device.type"
+	locationIPTag     = "ai.location.ip"
+)
+
+// maxTagLengths are the maximum lengths of the context tags
+// accepted by Application Insights.
+var maxTagLengths = map[string]int{
+	userIdTag:         128,
+	userAuthUserIdTag: 1024,
+	sessionIdTag:      64,
+	deviceTypeTag:     64,
+	locationIPTag:     46,
+}
+
+// DefaultTagAttributes returns the default value of [HandlerOptions.TagAttributes],
+// which maps the attributes named after the semantic conventions of OpenTelemetry
+// to the context tags of the user, the session and the device:
+//
+//   - "user.id" to "ai.user.id"
+//   - "enduser.id" to "ai.user.authUserId"
+//   - "session.id" to "ai.session.id"
+//   - "device.type" to "ai.device.type"
+//   - "client.address" to "ai.location.ip"
+func DefaultTagAttributes() map[string]string {
+	return map[string]string{
+		"user.id":        userIdTag,
+		"enduser.id":     userAuthUserIdTag,
+		"session.id":     sessionIdTag,
+		"device.type":    deviceTypeTag,
+		"client.address": locationIPTag,
+	}
+}
+
+// writeTag writes the attribute value to the context tag.
+func writeTag(tags map[string]string, tag string, v slog.Value) {
+	value := formatValue(v, FormatValues)
+	if value == "" {
+		return
+	}
+	if n, found := maxTagLengths[tag]; found {
+		value = truncate(value, n)
+	}
+	tags[tag] = value
+}
+
+// cloneTags returns a copy of the context tags which can be written.
+func cloneTags(tags map[string]string) map[string]string {
+	cloned := make(map[string]string, len(tags))
+	maps.Copy(cloned, tags)
+	return cloned
+}
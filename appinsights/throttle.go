@@ -0,0 +1,121 @@
+package appinsights
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var errThrottled = errors.New("submission throttled")
+
+// Bounds of the backoff applied when the endpoint throttles the submission.
+var (
+	throttleMinBackoff = time.Second
+	throttleMaxBackoff = 5 * time.Minute
+)
+
+// maxHeldBatches is the number of full batches which can be held back in memory
+// while the submission is throttled.
+const maxHeldBatches = 10
+
+// ThrottlingStats are the statistics of the throttling by the ingestion endpoint.
+type ThrottlingStats struct {
+	// Throttled is the number of responses which throttled the submission.
+	Throttled int64
+	// Held is the number of log records held back while the submission was throttled.
+	Held int64
+	// Dropped is the number of log records dropped while the submission was throttled.
+	Dropped int64
+}
+
+// throttle holds back the submissions while the endpoint throttles them.
+// It is shared by all handlers derived from the same handler.
+type throttle struct {
+	mu    sync.Mutex
+	until time.Time
+	// attempts is the number of consecutive throttled responses.
+	attempts int
+
+	throttled atomic.Int64
+	held      atomic.Int64
+	dropped   atomic.Int64
+}
+
+// throttle holds back the submissions for the delay requested by the endpoint
+// or for the exponential backoff with jitter, whichever is longer.
+func (t *throttle) throttle(retryAfter time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	backoff := throttleMinBackoff << min(t.attempts, 30)
+	if backoff <= 0 || backoff > throttleMaxBackoff {
+		backoff = throttleMaxBackoff
+	}
+	backoff = backoff/2 + rand.N(backoff/2+1)
+	t.attempts++
+
+	until := time.Now().Add(max(backoff, retryAfter))
+	if until.After(t.until) {
+		t.until = until
+	}
+	t.throttled.Add(1)
+
+	diagnosticsf("Submission throttled until %s", t.until.Format(time.RFC3339))
+}
+
+// reset clears the backoff after a submission was accepted.
+func (t *throttle) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.attempts = 0
+}
+
+// remaining returns the time until the submission can be resumed,
+// which is zero if the submission is not throttled.
+func (t *throttle) remaining() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return max(time.Until(t.until), 0)
+}
+
+func (t *throttle) stats() ThrottlingStats {
+	return ThrottlingStats{
+		Throttled: t.throttled.Load(),
+		Held:      t.held.Load(),
+		Dropped:   t.dropped.Load(),
+	}
+}
+
+// isThrottlingStatus reports whether the status code asks the client to slow down.
+func isThrottlingStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests,
+		439, // too many requests over extended time
+		http.StatusServiceUnavailable:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseRetryAfter parses the value of the Retry-After header,
+// which is either a number of seconds or an HTTP date.
+// It returns zero if the value is missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
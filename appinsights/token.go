@@ -0,0 +1,182 @@
+package appinsights
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultAADAudience is the audience of the tokens for the ingestion
+	// when the connection string does not specify one.
+	defaultAADAudience = "https://monitor.azure.com/"
+	// aadAuthorization is the value of Authorization in the connection string
+	// which requires the tokens of Microsoft Entra ID.
+	aadAuthorization = "aad"
+)
+
+const (
+	defaultIMDSEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+	imdsAPIVersion      = "2018-02-01"
+	// tokenRefreshMargin is the time before the expiration
+	// at which a cached token is refreshed.
+	tokenRefreshMargin = 5 * time.Minute
+)
+
+// Token is an access token of Microsoft Entra ID.
+type Token struct {
+	// Value is the bearer token attached to the requests.
+	Value string
+	// ExpiresOn is the time when the token expires.
+	ExpiresOn time.Time
+}
+
+// TokenProvider provides the access tokens of Microsoft Entra ID
+// for the resources which disable the local authentication.
+type TokenProvider interface {
+	// Token returns a token for the given scope,
+	// such as "https://monitor.azure.com//.default".
+	// It is called for every request to the ingestion endpoint,
+	// so the implementation should cache the token until it expires.
+	Token(ctx context.Context, scope string) (Token, error)
+}
+
+// tokenInvalidator is implemented by the token providers
+// which discard the cached token rejected by the ingestion endpoint.
+type tokenInvalidator interface {
+	invalidateToken(scope string, token Token)
+}
+
+// ManagedIdentityTokenProvider is a [TokenProvider] which obtains the tokens
+// of the managed identity from the Azure Instance Metadata Service (IMDS).
+// The cached token is discarded when the ingestion endpoint rejects it.
+// The zero value uses the system-assigned managed identity.
+type ManagedIdentityTokenProvider struct {
+	// ClientID is the client ID of the user-assigned managed identity.
+	// The system-assigned managed identity is used if this is empty.
+	ClientID string
+	// Endpoint is the token endpoint of IMDS.
+	// Default value is "http://169.254.169.254/metadata/identity/oauth2/token".
+	Endpoint string
+	// Client is a customized HTTP client.
+	Client *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]Token
+}
+
+// imdsToken is the response body of IMDS.
+type imdsToken struct {
+	AccessToken string `json:"access_token"`
+	ExpiresOn   string `json:"expires_on"`
+	ExpiresIn   string `json:"expires_in"`
+}
+
+// Token returns the cached token for the scope,
+// or requests a new one from IMDS if the cached one is about to expire.
+func (p *ManagedIdentityTokenProvider) Token(ctx context.Context, scope string) (Token, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if token, found := p.tokens[scope]; found && time.Until(token.ExpiresOn) > tokenRefreshMargin {
+		return token, nil
+	}
+
+	token, err := p.requestToken(ctx, scope)
+	if err != nil {
+		return Token{}, err
+	}
+
+	if p.tokens == nil {
+		p.tokens = make(map[string]Token)
+	}
+	p.tokens[scope] = token
+
+	return token, nil
+}
+
+// invalidateToken discards the token if it is still cached for the scope.
+func (p *ManagedIdentityTokenProvider) invalidateToken(scope string, token Token) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if cached, found := p.tokens[scope]; found && cached.Value == token.Value {
+		delete(p.tokens, scope)
+	}
+}
+
+func (p *ManagedIdentityTokenProvider) requestToken(ctx context.Context, scope string) (Token, error) {
+
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = defaultIMDSEndpoint
+	}
+
+	query := url.Values{}
+	query.Set("api-version", imdsAPIVersion)
+	query.Set("resource", strings.TrimSuffix(scope, "/.default"))
+	if p.ClientID != "" {
+		query.Set("client_id", p.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Metadata", "true")
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to read token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Token{}, fmt.Errorf("token request failed with status %d: %s", resp.StatusCode, body)
+	}
+
+	var response imdsToken
+	if err := json.Unmarshal(body, &response); err != nil {
+		return Token{}, fmt.Errorf("failed to parse token: %w", err)
+	}
+	if response.AccessToken == "" {
+		return Token{}, errors.New("token response has no access token")
+	}
+
+	token := Token{Value: response.AccessToken}
+	if seconds, err := strconv.ParseInt(response.ExpiresOn, 10, 64); err == nil {
+		token.ExpiresOn = time.Unix(seconds, 0)
+	} else if seconds, err := strconv.ParseInt(response.ExpiresIn, 10, 64); err == nil {
+		token.ExpiresOn = time.Now().Add(time.Duration(seconds) * time.Second)
+	}
+
+	diagnosticsf("Obtained token of managed identity expiring at %s", token.ExpiresOn.Format(time.RFC3339))
+
+	return token, nil
+}
+
+// tokenScope returns the scope of the tokens for the ingestion.
+func tokenScope(cs *ConnectionString) string {
+	audience := cs.AADAudience
+	if audience == "" {
+		audience = defaultAADAudience
+	}
+	return audience + "/.default"
+}
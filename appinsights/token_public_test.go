@@ -0,0 +1,99 @@
+package appinsights_test
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openclosed-dev/slogan/appinsights"
+)
+
+func TestManagedIdentityTokenProvider(t *testing.T) {
+
+	var mu sync.Mutex
+	var tokenRequests int
+	var authorizations []string
+
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		tokenRequests++
+
+		query := req.URL.Query()
+		if req.Header.Get("Metadata") != "true" ||
+			query.Get("resource") != "https://monitor.azure.com/" ||
+			query.Get("client_id") != "client1" {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		expiresOn := time.Now().Add(time.Hour).Unix()
+		fmt.Fprintf(w, `{"access_token":"token1","expires_on":"%s","token_type":"Bearer"}`,
+			strconv.FormatInt(expiresOn, 10))
+	}))
+	defer imds.Close()
+
+	ingestion := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		authorizations = append(authorizations, req.Header.Get("Authorization"))
+	}))
+	defer ingestion.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = ingestion.Client()
+	opts.MaxBatchSize = 1
+	opts.TokenProvider = &appinsights.ManagedIdentityTokenProvider{
+		ClientID: "client1",
+		Endpoint: imds.URL,
+	}
+
+	connectionString := fmt.Sprintf(
+		"InstrumentationKey=%s;IngestionEndpoint=%s;Authorization=AAD",
+		instrumentationKey, ingestion.URL,
+	)
+
+	handler, err := appinsights.NewHandler(connectionString, opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler)
+	logger.Info("first")
+	logger.Info("second")
+
+	if err := handler.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if tokenRequests != 1 {
+		t.Errorf("expected 1 token request, but got %d", tokenRequests)
+	}
+	if len(authorizations) != 2 {
+		t.Fatalf("expected 2 requests, but got %d", len(authorizations))
+	}
+	for _, authorization := range authorizations {
+		if authorization != "Bearer token1" {
+			t.Errorf("unexpected authorization: %s", authorization)
+		}
+	}
+}
+
+func TestAADAuthorizationWithoutTokenProvider(t *testing.T) {
+
+	connectionString := fmt.Sprintf(
+		"InstrumentationKey=%s;IngestionEndpoint=https://example.org/;Authorization=AAD",
+		instrumentationKey,
+	)
+
+	if _, err := appinsights.NewHandler(connectionString, nil); err == nil {
+		t.Error("must be error")
+	}
+}
@@ -0,0 +1,78 @@
+package appinsights
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChannelRetriesWithNewTokenWhenRejected(t *testing.T) {
+
+	saved := retryDelays
+	retryDelays = []time.Duration{time.Millisecond}
+	defer func() { retryDelays = saved }()
+
+	var mu sync.Mutex
+	var tokenRequests int
+	var authorizations []string
+
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		tokenRequests++
+		fmt.Fprintf(w, `{"access_token":"token%d","expires_on":"%d","token_type":"Bearer"}`,
+			tokenRequests, time.Now().Add(time.Hour).Unix())
+	}))
+	defer imds.Close()
+
+	// The first token is revoked before its expiration.
+	ingestion := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		authorization := req.Header.Get("Authorization")
+		authorizations = append(authorizations, authorization)
+		if authorization == "Bearer token1" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer ingestion.Close()
+
+	transmitter := newTransmitter(ingestion.URL, ingestion.Client())
+	transmitter.tokenProvider = &ManagedIdentityTokenProvider{Endpoint: imds.URL}
+	transmitter.scope = defaultAADAudience + "/.default"
+
+	failures := newFailureReporter(nil)
+	failures.startCollecting()
+
+	channel := newTelemetryChannel(transmitter, nil, failures, 100, time.Hour)
+	channel.send(newTestEnvelope())
+	<-channel.close(context.Background())
+
+	if err := failures.collectedError(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if tokenRequests != 2 {
+		t.Errorf("expected 2 token requests, but got %d", tokenRequests)
+	}
+	if !slices.Equal(authorizations, []string{"Bearer token1", "Bearer token2"}) {
+		t.Errorf("unexpected authorizations: %v", authorizations)
+	}
+}
+
+func TestAuthorizationFailureIsPermanentWithoutToken(t *testing.T) {
+
+	for _, statusCode := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+		result := &transmissionResult{statusCode: statusCode}
+		if result.canRetry() {
+			t.Errorf("status %d must not be retried without token", statusCode)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package appinsights
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// TransmissionError reports the log records
+// which could not be delivered to Application Insights.
+type TransmissionError struct {
+	// Dropped is the number of log records which were not delivered.
+	Dropped int
+	// StatusCodes are the HTTP status codes of the failed requests.
+	StatusCodes []int
+	// ItemErrors are the errors of the individual log records
+	// reported by the ingestion endpoint.
+	ItemErrors []ItemError
+	// Err is the underlying error such as a network failure, which may be nil.
+	Err error
+}
+
+// ItemError is an error of a log record reported by the ingestion endpoint.
+type ItemError struct {
+	// Index is the position of the log record in the batch of the request.
+	Index int `json:"index"`
+	// StatusCode is the status code for the log record.
+	StatusCode int `json:"statusCode"`
+	// Message is the error message for the log record.
+	Message string `json:"message"`
+}
+
+// Error returns the description of the error.
+func (e *TransmissionError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d log records were not delivered", e.Dropped)
+	if len(e.StatusCodes) > 0 {
+		fmt.Fprintf(&b, ", status codes: %v", e.StatusCodes)
+	}
+	if len(e.ItemErrors) > 0 {
+		fmt.Fprintf(&b, ", first item error: %d %s", e.ItemErrors[0].StatusCode, e.ItemErrors[0].Message)
+	}
+	if e.Err != nil {
+		fmt.Fprintf(&b, ": %v", e.Err)
+	}
+	return b.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *TransmissionError) Unwrap() error {
+	return e.Err
+}
+
+// merge adds the content of other to e.
+func (e *TransmissionError) merge(other *TransmissionError) {
+	e.Dropped += other.Dropped
+	for _, code := range other.StatusCodes {
+		if !slices.Contains(e.StatusCodes, code) {
+			e.StatusCodes = append(e.StatusCodes, code)
+		}
+	}
+	e.ItemErrors = append(e.ItemErrors, other.ItemErrors...)
+	if other.Err != nil {
+		e.Err = errors.Join(e.Err, other.Err)
+	}
+}
+
+// maxQueuedFailures is the number of failures which can wait to be notified
+// to OnError; further failures are merged into the last one waiting.
+const maxQueuedFailures = 100
+
+// failureReporter notifies the failures of transmission
+// and collects those occurred while the channel is closing.
+// The failures are notified to onError from a background goroutine,
+// so that reporting never blocks nor calls back into the caller.
+type failureReporter struct {
+	onError func(err error, droppedCount int)
+
+	mu         sync.Mutex
+	collecting bool
+	collected  *TransmissionError
+	// queue holds the failures waiting to be notified.
+	queue []*TransmissionError
+	// notifying is true while a goroutine notifies the queued failures.
+	notifying bool
+	// notified is closed when the goroutine has notified all the failures.
+	notified chan struct{}
+	// calling is true while onError is called.
+	calling bool
+}
+
+func newFailureReporter(onError func(error, int)) *failureReporter {
+	return &failureReporter{onError: onError}
+}
+
+// report notifies the failure.
+func (r *failureReporter) report(err *TransmissionError) {
+	r.add(err, true)
+}
+
+// reportRejected reports the failure of the items rejected on submission,
+// which is not notified while onError is called,
+// so that the records logged by onError cannot feed back into it.
+func (r *failureReporter) reportRejected(err *TransmissionError) {
+	r.add(err, false)
+}
+
+// add collects the failure and queues it to be notified.
+// The failure is not notified if onError is being called and reentrant is false.
+func (r *failureReporter) add(err *TransmissionError, reentrant bool) {
+	diagnosticsf("Dropped telemetry: %v", err)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.collecting {
+		if r.collected == nil {
+			r.collected = &TransmissionError{}
+		}
+		r.collected.merge(err)
+	}
+
+	if r.onError == nil || (r.calling && !reentrant) {
+		return
+	}
+	if len(r.queue) < maxQueuedFailures {
+		r.queue = append(r.queue, err)
+	} else {
+		merged := *r.queue[len(r.queue)-1]
+		merged.merge(err)
+		r.queue[len(r.queue)-1] = &merged
+	}
+	if !r.notifying {
+		r.notifying = true
+		r.notified = make(chan struct{})
+		go r.notify()
+	}
+}
+
+// notify calls onError with the queued failures until the queue is empty.
+func (r *failureReporter) notify() {
+	for {
+		r.mu.Lock()
+		queue := r.queue
+		r.queue = nil
+		if len(queue) == 0 {
+			r.notifying = false
+			close(r.notified)
+			r.mu.Unlock()
+			return
+		}
+		r.calling = true
+		r.mu.Unlock()
+
+		for _, err := range queue {
+			r.onError(err, err.Dropped)
+		}
+
+		r.mu.Lock()
+		r.calling = false
+		r.mu.Unlock()
+	}
+}
+
+// wait waits until the failures reported so far are notified or ctx is done.
+func (r *failureReporter) wait(ctx context.Context) {
+	r.mu.Lock()
+	if !r.notifying {
+		r.mu.Unlock()
+		return
+	}
+	notified := r.notified
+	r.mu.Unlock()
+
+	select {
+	case <-notified:
+	case <-ctx.Done():
+	}
+}
+
+// startCollecting begins to collect the failures.
+func (r *failureReporter) startCollecting() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collecting = true
+}
+
+// collectedError returns the failures collected so far,
+// or nil if there was no failure.
+func (r *failureReporter) collectedError() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.collected == nil {
+		return nil
+	}
+	collected := *r.collected
+	return &collected
+}
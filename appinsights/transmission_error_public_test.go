@@ -0,0 +1,345 @@
+package appinsights_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openclosed-dev/slogan/appinsights"
+)
+
+// newRejectingServer creates a server which rejects all items
+// with the given status code.
+func newRejectingServer(statusCode int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		items, err := decodeRequestBody(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		fmt.Fprintf(w, `{"itemsReceived":%d,"itemsAccepted":0,"errors":[`, len(items))
+		for i := range items {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, `{"index":%d,"statusCode":%d,"message":"invalid item"}`, i, statusCode)
+		}
+		fmt.Fprint(w, `]}`)
+	}))
+}
+
+func TestCloseReturnsTransmissionError(t *testing.T) {
+
+	server := newRejectingServer(http.StatusBadRequest)
+	defer server.Close()
+
+	var mu sync.Mutex
+	var reported []int
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.OnError = func(err error, droppedCount int) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported = append(reported, droppedCount)
+	}
+
+	connectionString := fmt.Sprintf(
+		"InstrumentationKey=%s;IngestionEndpoint=%s;",
+		instrumentationKey, server.URL,
+	)
+
+	handler, err := appinsights.NewHandler(connectionString, opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler)
+	logger.Info("first")
+	logger.Info("second")
+
+	err = handler.Close()
+
+	var transmissionError *appinsights.TransmissionError
+	if !errors.As(err, &transmissionError) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if transmissionError.Dropped != 2 {
+		t.Errorf("expected 2 dropped records, but got %d", transmissionError.Dropped)
+	}
+	if !slices.Equal(transmissionError.StatusCodes, []int{http.StatusBadRequest}) {
+		t.Errorf("unexpected status codes: %v", transmissionError.StatusCodes)
+	}
+	if len(transmissionError.ItemErrors) != 2 {
+		t.Errorf("expected 2 item errors, but got %d", len(transmissionError.ItemErrors))
+	} else if transmissionError.ItemErrors[1].Message != "invalid item" {
+		t.Errorf("unexpected item error: %v", transmissionError.ItemErrors[1])
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(reported, []int{2}) {
+		t.Errorf("unexpected dropped counts: %v", reported)
+	}
+}
+
+func TestCloseReturnsNilOnSuccess(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	logger := slog.New(handler)
+	logger.Info("message")
+
+	if err := handler.Close(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLogAfterClose(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	var dropped atomic.Int64
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.OnError = func(err error, droppedCount int) {
+		dropped.Add(int64(droppedCount))
+	}
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	handler.Close()
+
+	logger := slog.New(handler)
+	logger.Info("message")
+
+	var transmissionError *appinsights.TransmissionError
+	if err := handler.Close(); !errors.As(err, &transmissionError) || transmissionError.Dropped != 1 {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if n := dropped.Load(); n != 1 {
+		t.Errorf("expected 1 dropped record, but got %d", n)
+	}
+}
+
+func TestShutdownHonorsDeadline(t *testing.T) {
+
+	server := newRejectingServer(http.StatusServiceUnavailable)
+	defer server.Close()
+
+	var reported atomic.Int64
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.OnError = func(err error, droppedCount int) {
+		reported.Add(int64(droppedCount))
+	}
+
+	connectionString := fmt.Sprintf(
+		"InstrumentationKey=%s;IngestionEndpoint=%s;",
+		instrumentationKey, server.URL,
+	)
+
+	handler, err := appinsights.NewHandler(connectionString, opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	slog.New(handler).Info("message")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	startTime := time.Now()
+	err = handler.Shutdown(ctx)
+	if elapsed := time.Since(startTime); elapsed > 5*time.Second {
+		t.Errorf("shutdown took too long: %s", elapsed)
+	}
+
+	var transmissionError *appinsights.TransmissionError
+	if !errors.As(err, &transmissionError) || transmissionError.Dropped != 1 {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// The transmissions in progress must not report the items again.
+	time.Sleep(200 * time.Millisecond)
+	if n := reported.Load(); n != 1 {
+		t.Errorf("dropped items must be reported once, but reported %d", n)
+	}
+}
+
+func TestShutdownCancelsHungTransmission(t *testing.T) {
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	var reported atomic.Int64
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.OnError = func(err error, droppedCount int) {
+		reported.Add(int64(droppedCount))
+	}
+
+	connectionString := fmt.Sprintf(
+		"InstrumentationKey=%s;IngestionEndpoint=%s;",
+		instrumentationKey, server.URL,
+	)
+
+	handler, err := appinsights.NewHandler(connectionString, opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	slog.New(handler).Info("message")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	startTime := time.Now()
+	err = handler.Shutdown(ctx)
+	if elapsed := time.Since(startTime); elapsed > 5*time.Second {
+		t.Errorf("shutdown took too long: %s", elapsed)
+	}
+
+	var transmissionError *appinsights.TransmissionError
+	if !errors.As(err, &transmissionError) || transmissionError.Dropped != 1 {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// OnError is called in the background after the deadline.
+	for deadline := time.Now().Add(5 * time.Second); reported.Load() == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := reported.Load(); n != 1 {
+		t.Errorf("dropped items must be reported once, but reported %d", n)
+	}
+}
+
+func TestLogFromOnErrorWhileThrottled(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	var logger *slog.Logger
+	var reported atomic.Int64
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.MaxBatchSize = 1
+	opts.OnError = func(err error, droppedCount int) {
+		reported.Add(int64(droppedCount))
+		logger.Warn("telemetry dropped", "count", droppedCount)
+	}
+
+	connectionString := fmt.Sprintf(
+		"InstrumentationKey=%s;IngestionEndpoint=%s;",
+		instrumentationKey, server.URL,
+	)
+
+	handler, err := appinsights.NewHandler(connectionString, opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	logger = slog.New(handler)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 100 {
+			logger.Info("message", "index", i)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logging blocked while throttled")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	handler.Shutdown(ctx)
+
+	for deadline := time.Now().Add(5 * time.Second); reported.Load() < 100 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := reported.Load(); n < 100 {
+		t.Errorf("expected at least 100 dropped records, but got %d", n)
+	}
+}
+
+func TestLogFromOnErrorAfterClose(t *testing.T) {
+
+	server := newStubServer(8)
+	defer server.Close()
+
+	var logger *slog.Logger
+	var reported atomic.Int64
+
+	opts := appinsights.NewHandlerOptions(nil)
+	opts.Client = server.Client()
+	opts.OnError = func(err error, droppedCount int) {
+		reported.Add(1)
+		logger.Warn("telemetry dropped", "count", droppedCount)
+	}
+
+	handler, err := appinsights.NewHandler(server.connectionString(), opts)
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+	logger = slog.New(handler)
+	handler.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		logger.Info("message")
+		handler.Close()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logging blocked after close")
+	}
+
+	// The record logged by OnError must not be reported again.
+	time.Sleep(100 * time.Millisecond)
+	if n := reported.Load(); n != 1 {
+		t.Errorf("expected OnError to be called once, but called %d times", n)
+	}
+}
@@ -0,0 +1,221 @@
+package appinsights
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// transmitter submits batches of telemetry items to the ingestion endpoint.
+type transmitter struct {
+	endpoint string
+	client   *http.Client
+	// tokenProvider provides the bearer tokens, which may be nil.
+	tokenProvider TokenProvider
+	scope         string
+}
+
+// transmissionResult is the result of a request to the ingestion endpoint.
+type transmissionResult struct {
+	statusCode int
+	// response is the parsed response body, which may be nil.
+	response *trackResponse
+	// retryAfter is the delay requested by the Retry-After header, which may be zero.
+	retryAfter time.Duration
+	// tokenRejected is true if the endpoint rejected the token,
+	// in which case the batch is submitted again with a new token.
+	tokenRejected bool
+}
+
+// trackResponse is the response body returned by the ingestion endpoint.
+type trackResponse struct {
+	ItemsReceived int         `json:"itemsReceived"`
+	ItemsAccepted int         `json:"itemsAccepted"`
+	Errors        []ItemError `json:"errors"`
+}
+
+func newTransmitter(endpoint string, client *http.Client) *transmitter {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &transmitter{
+		endpoint: endpoint,
+		client:   client,
+	}
+}
+
+// transmit posts the batch of telemetry items.
+// The request is aborted when ctx is done.
+func (t *transmitter) transmit(ctx context.Context, b batch) (*transmissionResult, error) {
+
+	payload, err := b.compress()
+	if err != nil {
+		return nil, err
+	}
+
+	diagnosticsf("Transmitting %d items", len(b))
+	startTime := time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Content-Type", "application/x-json-stream")
+
+	var token Token
+	if t.tokenProvider != nil {
+		token, err = t.tokenProvider.Token(ctx, t.scope)
+		if err != nil {
+			diagnosticsf("Failed to obtain token: %v", err)
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token.Value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		diagnosticsf("Failed to transmit telemetry: %v", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		diagnosticsf("Failed to read response: %v", err)
+		return nil, err
+	}
+
+	result := &transmissionResult{
+		statusCode: resp.StatusCode,
+		retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+
+	// The token may have been revoked or lost its permissions before its expiration.
+	if t.tokenProvider != nil && isAuthorizationStatus(resp.StatusCode) {
+		result.tokenRejected = true
+		if invalidator, ok := t.tokenProvider.(tokenInvalidator); ok {
+			invalidator.invalidateToken(t.scope, token)
+		}
+	}
+
+	var response trackResponse
+	if err := json.Unmarshal(body, &response); err == nil {
+		result.response = &response
+	}
+
+	diagnosticsf("Telemetry transmitted in %s with status %d", time.Since(startTime), resp.StatusCode)
+	if response := result.response; response != nil {
+		diagnosticsf("Items accepted/received: %d/%d", response.ItemsAccepted, response.ItemsReceived)
+		for _, e := range response.Errors {
+			diagnosticsf("#%d - %d %s", e.Index, e.StatusCode, e.Message)
+		}
+	}
+
+	return result, nil
+}
+
+// isSuccess reports whether all items were accepted.
+func (r *transmissionResult) isSuccess() bool {
+	return r.statusCode == http.StatusOK ||
+		(r.statusCode == http.StatusPartialContent &&
+			r.response != nil &&
+			r.response.ItemsReceived == r.response.ItemsAccepted)
+}
+
+// isPartialSuccess reports whether some of the items were accepted
+// and the others are listed in the response.
+func (r *transmissionResult) isPartialSuccess() bool {
+	return r.statusCode == http.StatusPartialContent && r.response != nil
+}
+
+// canRetry reports whether the whole batch can be submitted again.
+func (r *transmissionResult) canRetry() bool {
+	return isRetryableStatus(r.statusCode) || r.tokenRejected
+}
+
+// isThrottled reports whether the endpoint asked to slow down the submission.
+func (r *transmissionResult) isThrottled() bool {
+	return isThrottlingStatus(r.statusCode)
+}
+
+// split divides the items of the batch into those to be submitted again
+// and those rejected permanently, the latter of which may be nil.
+func (r *transmissionResult) split(b batch) (batch, *TransmissionError) {
+	switch {
+	case r.isSuccess():
+		return nil, nil
+
+	case r.isPartialSuccess():
+		var retry batch
+		rejected := &TransmissionError{StatusCodes: []int{r.statusCode}}
+		for _, e := range r.response.Errors {
+			if e.Index < 0 || e.Index >= len(b) {
+				continue
+			}
+			if isRetryableStatus(e.StatusCode) {
+				retry = append(retry, b[e.Index])
+			} else {
+				rejected.Dropped++
+				rejected.ItemErrors = append(rejected.ItemErrors, e)
+			}
+		}
+		// The items not accepted but missing in the errors cannot be identified.
+		unknown := r.response.ItemsReceived - r.response.ItemsAccepted - len(retry) - rejected.Dropped
+		rejected.Dropped += max(unknown, 0)
+		if rejected.Dropped == 0 {
+			return retry, nil
+		}
+		return retry, rejected
+
+	case r.canRetry():
+		return b, nil
+
+	default:
+		rejected := &TransmissionError{Dropped: len(b), StatusCodes: []int{r.statusCode}}
+		if r.response != nil {
+			rejected.ItemErrors = slices.Clone(r.response.Errors)
+		}
+		return nil, rejected
+	}
+}
+
+// addTo adds the status code and the errors of the items to be retried to the failure.
+func (r *transmissionResult) addTo(failure *TransmissionError) {
+	if !slices.Contains(failure.StatusCodes, r.statusCode) {
+		failure.StatusCodes = append(failure.StatusCodes, r.statusCode)
+	}
+	failure.ItemErrors = nil
+	if r.response != nil {
+		for _, e := range r.response.Errors {
+			if isRetryableStatus(e.StatusCode) {
+				failure.ItemErrors = append(failure.ItemErrors, e)
+			}
+		}
+	}
+}
+
+func isRetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		439, // too many requests over extended time
+		http.StatusInternalServerError,
+		http.StatusServiceUnavailable:
+		return true
+	default:
+		return false
+	}
+}
+
+// isAuthorizationStatus reports whether the request was rejected
+// because of its token.
+func isAuthorizationStatus(statusCode int) bool {
+	return statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden
+}
@@ -26,7 +26,12 @@ func main() {
 			"Error: Failed to create log handler: %v.\n", err)
 		os.Exit(1)
 	}
-	defer handler.Close()
+	defer func() {
+		if err := handler.Close(); err != nil {
+			fmt.Fprintf(os.Stderr,
+				"Error: Failed to send lines: %v.\n", err)
+		}
+	}()
 
 	slog.SetDefault(slog.New(handler))
 
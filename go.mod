@@ -2,9 +2,6 @@ module github.com/openclosed-dev/slogan
 
 go 1.23.0
 
-require github.com/microsoft/ApplicationInsights-Go v0.4.4
+require go.opentelemetry.io/otel/trace v1.38.0
 
-require (
-	code.cloudfoundry.org/clock v0.0.0-20180518195852-02e53af36e6c // indirect
-	github.com/gofrs/uuid v3.3.0+incompatible // indirect
-)
+require go.opentelemetry.io/otel v1.38.0 // indirect